@@ -0,0 +1,41 @@
+package newvm
+
+import "context"
+
+// API - NewVM API operations used by the provider resources and data sources
+type API interface {
+	// Catalog
+	GetControlPanelProducts(ctx context.Context) ([]ControlPanelProduct, error)
+	GetLocations(ctx context.Context) ([]Location, error)
+	GetOperatingSystems(ctx context.Context) ([]OperatingSystem, error)
+	GetVmProducts(ctx context.Context) ([]VmProduct, error)
+
+	// Control panels
+	GetControlPanel(ctx context.Context, orderID int64) (*ControlPanel, error)
+	CreateControlPanel(ctx context.Context, controlPanel ControlPanel) (*ControlPanel, error)
+	UpdateControlPanel(ctx context.Context, orderID int64, controlPanel ControlPanel) (*ControlPanel, error)
+	DeleteControlPanel(ctx context.Context, orderID int64, policy DeletionPolicy) (string, error)
+
+	// Orders
+	GetAllOrders(ctx context.Context) ([]NewVmOrder, error)
+	GetOrder(ctx context.Context, orderID string) (*NewVmOrder, error)
+	GetOrderByReference(ctx context.Context, reference string) (*NewVmOrder, error)
+
+	// VMs
+	GetVm(ctx context.Context, orderID string) (*Vm, error)
+	CreateVm(ctx context.Context, vm Vm) (*Vm, error)
+	UpdateVm(ctx context.Context, orderID string, vmOld *Vm, vmNew Vm) (*Vm, error)
+	DeleteVm(ctx context.Context, orderID string, policy DeletionPolicy, endChildOrders bool) (string, error)
+	WaitForVm(ctx context.Context, orderID string) (*Vm, error)
+
+	// VPCs
+	GetVpcs(ctx context.Context) ([]Vpc, error)
+	GetVpcMembers(ctx context.Context) ([]VpcMember, error)
+	GetVpc(ctx context.Context, ID string) (*Vpc, error)
+	CreateVpc(ctx context.Context, vpc Vpc) (*Vpc, error)
+	UpdateVpc(ctx context.Context, ID string, vpc Vpc) error
+	DeleteVpc(ctx context.Context, ID string) error
+}
+
+// Ensure the client satisfies the API interface.
+var _ API = &Client{}
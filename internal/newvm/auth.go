@@ -1,6 +1,7 @@
 package newvm
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,21 +10,37 @@ import (
 )
 
 // Login - Get a new token for user
-func (c *Client) Login() (*AuthResponse, error) {
+func (c *Client) Login(ctx context.Context) (*AuthResponse, error) {
 	if c.Auth.Username == "" || c.Auth.Password == "" {
 		return nil, fmt.Errorf("define username and password")
 	}
+	if c.totpSecret != "" {
+		totp, err := c.nextTotp(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.Auth.Totp = totp
+	}
 	rb, err := json.Marshal(c.Auth)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/identity/v1", c.HostURL), strings.NewReader(string(rb)))
+	ctx = withoutReauthentication(ctx)
+	// a TOTP code may only be used once, so only password logins are replayed
+	if c.Auth.Totp == "" {
+		ctx = withRetrySafe(ctx)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/identity/v1", c.HostURL), strings.NewReader(string(rb)))
 	if err != nil {
 		return nil, err
 	}
 
 	body, err := c.doRequest(req)
+	if c.Auth.Totp != "" {
+		c.totpUsed = true
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -38,8 +55,8 @@ func (c *Client) Login() (*AuthResponse, error) {
 }
 
 // Logout - Revoke the token for a user
-func (c *Client) Logout() error {
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/identity/v1", c.HostURL), strings.NewReader(string("")))
+func (c *Client) Logout(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/identity/v1", c.HostURL), strings.NewReader(string("")))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,63 @@
+package newvm
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultCatalogTTL - How long the operating system, location and VPC lists are reused
+const DefaultCatalogTTL = 5 * time.Minute
+
+// WithCatalogTTL - Reuses catalog responses for ttl, zero disables the cache
+func WithCatalogTTL(ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		c.catalogTTL = ttl
+	}
+}
+
+// catalogCache memoises a catalog list for the lifetime of the client. The
+// lock is held while fetching, so concurrent callers wait for a single
+// request instead of all fetching the same list.
+type catalogCache[T any] struct {
+	mu      sync.Mutex
+	valid   bool
+	value   []T
+	fetched time.Time
+}
+
+// get returns the cached list, or fetches it when the cache is empty or
+// older than ttl by the clock now. Callers receive a copy they are free to
+// modify.
+func (cc *catalogCache[T]) get(ctx context.Context, ttl time.Duration, now func() time.Time, fetch func(context.Context) ([]T, error)) ([]T, error) {
+	if ttl <= 0 {
+		return fetch(ctx)
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if cc.valid && now().Sub(cc.fetched) < ttl {
+		return slices.Clone(cc.value), nil
+	}
+
+	value, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cc.value = value
+	cc.fetched = now()
+	cc.valid = true
+
+	return slices.Clone(value), nil
+}
+
+// invalidate drops the cached list, so the next get fetches it again.
+func (cc *catalogCache[T]) invalidate() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.valid = false
+	cc.value = nil
+}
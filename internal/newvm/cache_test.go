@@ -0,0 +1,126 @@
+package newvm
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"unithost-terraform/internal/newvmtest"
+)
+
+const (
+	locationsRequest = "GET /backend/com.newvm.network/v1/location"
+	vpcsRequest      = "GET /backend/com.newvm.network/v1/vxlan"
+)
+
+// newCacheTestClient returns a client for s that caches catalog lists for
+// ttl, with a clock that only moves when the returned function is called.
+func newCacheTestClient(t *testing.T, s *newvmtest.Server, ttl time.Duration) (*Client, func(time.Duration)) {
+	t.Helper()
+
+	client, err := NewClient(context.Background(), &s.URL, &s.Username, &s.Password, nil, WithCatalogTTL(ttl))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	now := time.Now()
+	client.now = func() time.Time { return now }
+	return client, func(d time.Duration) { now = now.Add(d) }
+}
+
+// fetches returns how often the API received request ("METHOD /path").
+func fetches(s *newvmtest.Server, request string) int {
+	count := 0
+	for _, received := range s.Requests() {
+		if received == request {
+			count++
+		}
+	}
+	return count
+}
+
+func TestCatalogCacheExpires(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client, advance := newCacheTestClient(t, s, time.Minute)
+
+	for _, step := range []struct {
+		advance  time.Duration
+		expected int
+	}{
+		{advance: 0, expected: 1},
+		{advance: 59 * time.Second, expected: 1},
+		{advance: time.Second, expected: 2},
+		{advance: 30 * time.Second, expected: 2},
+	} {
+		advance(step.advance)
+		if _, err := client.GetLocations(ctx); err != nil {
+			t.Fatalf("GetLocations: %v", err)
+		}
+		if count := fetches(s, locationsRequest); count != step.expected {
+			t.Fatalf("expected %d location requests after %s more, got %d", step.expected, step.advance, count)
+		}
+	}
+}
+
+func TestCatalogCacheInvalidatedByVpcChanges(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client, _ := newCacheTestClient(t, s, time.Hour)
+	vpcNumbers := func() []int32 {
+		t.Helper()
+		vpcs, err := client.GetVpcs(ctx)
+		if err != nil {
+			t.Fatalf("GetVpcs: %v", err)
+		}
+		var numbers []int32
+		for _, vpc := range vpcs {
+			numbers = append(numbers, vpc.Number)
+		}
+		return numbers
+	}
+
+	if numbers := vpcNumbers(); len(numbers) != 0 {
+		t.Fatalf("expected no VPCs, got %v", numbers)
+	}
+
+	created, err := client.CreateVpc(ctx, Vpc{Name: "backend"})
+	if err != nil {
+		t.Fatalf("CreateVpc: %v", err)
+	}
+	vpc, err := client.GetVpc(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetVpc: %v", err)
+	}
+	if numbers := vpcNumbers(); !slices.Equal(numbers, []int32{vpc.Number}) {
+		t.Fatalf("expected the created VPC %d to be listed, got %v", vpc.Number, numbers)
+	}
+
+	if err := client.DeleteVpc(ctx, created.ID); err != nil {
+		t.Fatalf("DeleteVpc: %v", err)
+	}
+	if numbers := vpcNumbers(); len(numbers) != 0 {
+		t.Fatalf("expected the deleted VPC to be gone, got %v", numbers)
+	}
+
+	// every list after a change is fetched, the next one is cached again
+	vpcNumbers()
+	if count := fetches(s, vpcsRequest); count != 3 {
+		t.Fatalf("expected 3 VPC list requests, got %d", count)
+	}
+}
+
+func TestCatalogCacheDisabled(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client, _ := newCacheTestClient(t, s, 0)
+
+	for i := range 3 {
+		if _, err := client.GetLocations(ctx); err != nil {
+			t.Fatalf("GetLocations: %v", err)
+		}
+		if count := fetches(s, locationsRequest); count != i+1 {
+			t.Fatalf("expected every call to fetch the locations, got %d requests for %d calls", count, i+1)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package newvm
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/time/rate"
 )
 
 // HostURL - Default NewVM URL
@@ -12,10 +17,51 @@ const HostURL string = "https://api.newvm.com"
 
 // Client -
 type Client struct {
-	HostURL    string
-	HTTPClient *http.Client
-	Token      string
-	Auth       AuthStruct
+	HostURL     string
+	HTTPClient  *http.Client
+	Token       string
+	Auth        AuthStruct
+	RetryPolicy RetryPolicy
+
+	tokenMu  sync.RWMutex // guards Token once the client is shared
+	loginMu  sync.Mutex   // serialises session refreshes
+	totpUsed bool         // the configured TOTP code was consumed by a login
+
+	totpSecret   string // shared secret to generate TOTP codes from
+	lastTotpStep int64  // TOTP time step of the last generated code
+
+	now func() time.Time // clock, replaced in tests
+
+	limiter *rate.Limiter // token bucket shared by all requests, nil for no limit
+	slots   chan struct{} // semaphore for the requests in flight, nil for no limit
+
+	tokenCache *TokenCache // on-disk session cache, nil when disabled
+
+	pollInterval time.Duration // wait between checks of orders in progress
+
+	billingTimezone *time.Location // timezone end dates of orders are calculated in
+
+	catalogTTL       time.Duration
+	operatingSystems catalogCache[OperatingSystem]
+	locations        catalogCache[Location]
+	vpcs             catalogCache[Vpc]
+}
+
+// ClientOption - Configures optional Client behaviour in NewClient
+type ClientOption func(*Client)
+
+// WithRetryPolicy - Sets the policy used to retry transient API failures
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.RetryPolicy = policy
+	}
+}
+
+// WithToken - Authenticates with a long-lived API token instead of logging in
+func WithToken(token string) ClientOption {
+	return func(c *Client) {
+		c.Token = token
+	}
 }
 
 // AuthStruct -
@@ -31,17 +77,41 @@ type AuthResponse struct {
 }
 
 // NewClient -
-func NewClient(host, username, password *string, totp *string) (*Client, error) {
+func NewClient(ctx context.Context, host, username, password *string, totp *string, opts ...ClientOption) (*Client, error) {
+	billingTimezone, err := time.LoadLocation(DefaultBillingTimezone)
+	if err != nil {
+		return nil, err
+	}
+
 	c := Client{
-		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		HTTPClient: &http.Client{Timeout: DefaultRequestTimeout},
 		// Default NewVM URL
-		HostURL: HostURL,
+		HostURL:      HostURL,
+		RetryPolicy:  DefaultRetryPolicy,
+		pollInterval: DefaultPollInterval,
+		catalogTTL:   DefaultCatalogTTL,
+		now:          time.Now,
+
+		billingTimezone: billingTimezone,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
 	}
 
 	if host != nil {
 		c.HostURL = *host
 	}
 
+	// An API token replaces the login, it only needs to be verified
+	if c.Token != "" {
+		err := c.verifyToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &c, nil
+	}
+
 	// If username or password not provided, return empty client
 	if username == nil || password == nil {
 		return &c, nil
@@ -57,48 +127,150 @@ func NewClient(host, username, password *string, totp *string) (*Client, error)
 		Totp:     *totp,
 	}
 
-	ar, err := c.Login()
+	if c.tokenCache != nil {
+		resumed, err := c.loadCachedToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if resumed {
+			return &c, nil
+		}
+	}
+
+	ar, err := c.Login(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	c.Token = ar.Token
+	c.setToken(ar.Token)
 
-	// make a request to verify token, this updates the roles and privileges
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/account/v1/token", c.HostURL), nil)
+	err = c.verifyToken(ctx)
 	if err != nil {
 		return nil, err
 	}
+	c.storeCachedToken(ctx)
 
-	_, err2 := c.doRequest(req)
-	if err2 != nil {
-		return nil, err2
+	return &c, nil
+}
+
+// verifyToken makes a request to verify the token, this updates the roles and privileges
+func (c *Client) verifyToken(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(withoutReauthentication(ctx), "GET", fmt.Sprintf("%s/account/v1/token", c.HostURL), nil)
+	if err != nil {
+		return err
 	}
 
-	return &c, nil
+	_, err = c.doRequest(req)
+	return err
+}
+
+func (c *Client) currentToken() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.Token
+}
+
+func (c *Client) setToken(token string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.Token = token
 }
 
 func (c *Client) doRequest(req *http.Request) ([]byte, error) {
-	token := c.Token
+	token := c.currentToken()
+	body, err := c.send(req, token)
+	if !isUnauthorized(err) || !c.canReauthenticate(req) {
+		return body, err
+	}
+
+	// the session expired, log in again and replay the request exactly once
+	tflog.Info(req.Context(), "NewVM session expired, logging in again", map[string]any{
+		"method": req.Method,
+		"path":   req.URL.Path,
+	})
+	if err := c.reauthenticate(req.Context(), token); err != nil {
+		return nil, err
+	}
+	if req.GetBody != nil {
+		reqBody, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = reqBody
+	}
+
+	return c.send(req, c.currentToken())
+}
+
+// send performs the request with the given token, retrying transient failures.
+func (c *Client) send(req *http.Request, token string) ([]byte, error) {
+	ctx := req.Context()
+	traceCtx := newTraceContext(ctx)
 
 	req.Header.Set("X-Auth-Token", token)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
 
-	res, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
+	requestBody := traceRequestBody(req)
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status: %d, body: %s", res.StatusCode, body)
-	}
+		release, err := c.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		started := time.Now()
+		res, err := c.HTTPClient.Do(req)
+		if attempt < c.RetryPolicy.MaxAttempts && shouldRetry(req, res, err) {
+			traceResponse(traceCtx, req, res, err, attempt, started, requestBody, nil)
+			wait := c.RetryPolicy.backoff(attempt, res)
+			fields := map[string]any{
+				"method":  req.Method,
+				"path":    req.URL.Path,
+				"attempt": attempt,
+				"wait":    wait.String(),
+			}
+			if err != nil {
+				fields["error"] = err.Error()
+			} else {
+				fields["status"] = res.StatusCode
+				_, _ = io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+			}
+			release()
+			tflog.Warn(ctx, "Retrying NewVM API request", fields)
+
+			if err := sleepContext(ctx, wait); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			release()
+			traceResponse(traceCtx, req, nil, err, attempt, started, requestBody, nil)
+			return nil, err
+		}
 
-	return body, err
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		release()
+		traceResponse(traceCtx, req, res, err, attempt, started, requestBody, body)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode != http.StatusOK {
+			return nil, newAPIError(req, res.StatusCode, body)
+		}
+
+		return body, nil
+	}
 }
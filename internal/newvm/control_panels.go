@@ -1,14 +1,16 @@
 package newvm
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
+	"maps"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
-	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
 type NewVmControlPanelWrapper struct {
@@ -16,7 +18,7 @@ type NewVmControlPanelWrapper struct {
 }
 
 // GetControlPanelProducts - Returns list of available control panel products (no auth required)
-func (c *Client) GetControlPanelProducts() ([]ControlPanelProduct, error) {
+func (c *Client) GetControlPanelProducts(ctx context.Context) ([]ControlPanelProduct, error) {
 	controlPanelProducts := []ControlPanelProduct{}
 
 	type IntermediateProduct struct {
@@ -30,7 +32,7 @@ func (c *Client) GetControlPanelProducts() ([]ControlPanelProduct, error) {
 	intermediates := []IntermediateProduct{}
 
 	// first we obtain all DirectAdmin products @hardcoded product ID
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/account/v1/product/CP_DIRECTADMIN", c.HostURL), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/product/CP_DIRECTADMIN", c.HostURL), nil)
 	if err != nil {
 		return nil, err
 	} else {
@@ -49,13 +51,13 @@ func (c *Client) GetControlPanelProducts() ([]ControlPanelProduct, error) {
 	}
 
 	// and then we add all Plesk products @hardcoded product ID
-	req, err = http.NewRequest("GET", fmt.Sprintf("%s/account/v1/product/CP_PLESK", c.HostURL), nil)
+	req, err = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/product/CP_PLESK", c.HostURL), nil)
 	if err != nil {
 		return nil, err
 	} else {
 		body, err := c.doRequest(req)
 		if err != nil {
-			log.Printf("Error during request: %v\n", err)
+			tflog.Warn(ctx, "Error during request", map[string]any{"error": err.Error()})
 			//return nil, err
 		} else {
 			intermediateProductPlesk := IntermediateProduct{}
@@ -101,11 +103,11 @@ func (c *Client) GetControlPanelProducts() ([]ControlPanelProduct, error) {
 }
 
 // GetControlPanel - Returns specific control panel details
-func (c *Client) GetControlPanel(orderID int64) (*ControlPanel, error) {
+func (c *Client) GetControlPanel(ctx context.Context, orderID int64) (*ControlPanel, error) {
 	if orderID > 0 {
 		// combine data from various API paths
 		// first obtain the order details
-		reqOrder, err := http.NewRequest("GET", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, strconv.FormatInt(orderID, 10)), nil)
+		reqOrder, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, strconv.FormatInt(orderID, 10)), nil)
 		if err != nil {
 			return nil, err
 		}
@@ -123,17 +125,13 @@ func (c *Client) GetControlPanel(orderID int64) (*ControlPanel, error) {
 		extensions := []ControlPanelExtension{}
 		for _, orderOption := range orderData.Order.Options {
 			switch orderOption.OptionID {
-			case "da_license":
-			case "plesk_12_license":
+			case "da_license", "plesk_12_license":
 				licenseType = orderOption.OptionID + "." + strconv.Itoa(orderOption.ItemCount)
 			}
 
 			if orderOption.Type == "flag" && orderOption.ItemCount == 1 {
 				switch orderOption.OptionID {
-				case "plesk_extension_dnssec":
-				case "plesk_extension_hosting_pack":
-				case "plesk_extension_powerpack":
-				case "plesk_extension_language_pack":
+				case "plesk_extension_dnssec", "plesk_extension_hosting_pack", "plesk_extension_powerpack", "plesk_extension_language_pack":
 					extensions = append(extensions, ControlPanelExtension{
 						ID:          orderOption.OptionID,
 						Description: orderOption.Description,
@@ -144,8 +142,9 @@ func (c *Client) GetControlPanel(orderID int64) (*ControlPanel, error) {
 		}
 
 		// merge outstanding change requests with the order details if any
+		pendingChangeAt := ""
 		if orderData.Order.NeedsChange == 1 {
-			reqChanges, err := http.NewRequest("GET", fmt.Sprintf("%s/account/v1/order/changerequest?orderId=%s", c.HostURL, strconv.FormatInt(orderID, 10)), nil)
+			reqChanges, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/order/changerequest?orderId=%s", c.HostURL, strconv.FormatInt(orderID, 10)), nil)
 			if err != nil {
 				return nil, err
 			}
@@ -158,10 +157,29 @@ func (c *Client) GetControlPanel(orderID int64) (*ControlPanel, error) {
 			if err != nil {
 				return nil, err
 			}
-			changeRequest := changesData.Changes[0]
-			newOptions := NewVmPricing{}
-			if err := json.Unmarshal([]byte(changeRequest.NewOptions), &newOptions); err != nil {
-				panic(err)
+			// pending change requests are applied in turn, each one over the former
+			for _, changeRequest := range pendingChangeRequests(changesData.Changes) {
+				newOptions := map[string]int{}
+				if err := json.Unmarshal([]byte(changeRequest.NewOptions), &newOptions); err != nil {
+					return nil, err
+				}
+				for _, optionID := range slices.Sorted(maps.Keys(newOptions)) {
+					itemCount := newOptions[optionID]
+					switch optionID {
+					case "da_license", "plesk_12_license":
+						licenseType = optionID + "." + strconv.Itoa(itemCount)
+					case "plesk_extension_dnssec", "plesk_extension_hosting_pack", "plesk_extension_powerpack", "plesk_extension_language_pack":
+						ordered := slices.IndexFunc(extensions, func(extension ControlPanelExtension) bool {
+							return extension.ID == optionID
+						})
+						if itemCount == 1 && ordered == -1 {
+							extensions = append(extensions, ControlPanelExtension{ID: optionID})
+						} else if itemCount == 0 && ordered != -1 {
+							extensions = slices.Delete(extensions, ordered, ordered+1)
+						}
+					}
+				}
+				pendingChangeAt = changeRequest.ScheduledDate
 			}
 		}
 
@@ -171,6 +189,9 @@ func (c *Client) GetControlPanel(orderID int64) (*ControlPanel, error) {
 			VmID:       orderData.Order.ParentID,
 			ProductID:  orderData.Order.ProductID + "." + licenseType,
 			Extensions: extensions,
+
+			PendingChangeAt: pendingChangeAt,
+			EndDate:         orderData.Order.EndDate,
 		}
 		err = json.Unmarshal(bodyOrder, &controlPanel)
 		if err != nil {
@@ -198,7 +219,7 @@ func splitControlPanelProductID(controlPanelProductID string) (string, int) {
 }
 
 // CreateControlPanel - Create new control panel order
-func (c *Client) CreateControlPanel(controlPanel ControlPanel) (*ControlPanel, error) {
+func (c *Client) CreateControlPanel(ctx context.Context, controlPanel ControlPanel) (*ControlPanel, error) {
 	// Order @NewVM Order structure
 	type NewVmOrderOption struct {
 		DirectAdminLicense int `json:"da_license,omitempty"`
@@ -254,6 +275,7 @@ func (c *Client) CreateControlPanel(controlPanel ControlPanel) (*ControlPanel, e
 		//Provisioning:     provisioning,
 		AutoProvision:    true,
 		FinishOrderGroup: true,
+		PromoCodes:       controlPanel.PromoCodes,
 	}
 
 	rb, err := json.Marshal(newVmOrder)
@@ -261,7 +283,7 @@ func (c *Client) CreateControlPanel(controlPanel ControlPanel) (*ControlPanel, e
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/account/v1/customer/self/order/%s", c.HostURL, productCode), strings.NewReader(string(rb)))
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/account/v1/customer/self/order/%s", c.HostURL, productCode), strings.NewReader(string(rb)))
 	if err != nil {
 		return nil, err
 	}
@@ -285,40 +307,51 @@ func (c *Client) CreateControlPanel(controlPanel ControlPanel) (*ControlPanel, e
 }
 
 // UpdateControlPanel - Updates an order
-func (c *Client) UpdateControlPanel(orderID int64, controlPanel ControlPanel) (*ControlPanel, error) {
+func (c *Client) UpdateControlPanel(ctx context.Context, orderID int64, controlPanel ControlPanel) (*ControlPanel, error) {
 	// Order @NewVM Change request structure
+	// Plesk extensions are always sent, 0 removes an extension
 	type NewVmChangeOption struct {
-		DirectAdminLicense int `json:"da_license,omitempty"`
-		PleskLicense       int `json:"plesk_12_license,omitempty"`
-		PleskDnssec        int `json:"plesk_extension_dnssec,omitempty"`
-		PleskHostingPack   int `json:"plesk_extension_hosting_pack,omitempty"`
-		PleskLanguagePack  int `json:"plesk_extension_language_pack,omitempty"`
-		PleskPowerPack     int `json:"plesk_extension_powerpack,omitempty"`
+		DirectAdminLicense int  `json:"da_license,omitempty"`
+		PleskLicense       int  `json:"plesk_12_license,omitempty"`
+		PleskDnssec        *int `json:"plesk_extension_dnssec,omitempty"`
+		PleskHostingPack   *int `json:"plesk_extension_hosting_pack,omitempty"`
+		PleskLanguagePack  *int `json:"plesk_extension_language_pack,omitempty"`
+		PleskPowerPack     *int `json:"plesk_extension_powerpack,omitempty"`
 	}
 	// @todo support custom.hardDiskSizes
 	type NewVmChangeRequest struct {
-		Options NewVmChangeOption `json:"options"`
+		Options       NewVmChangeOption `json:"options"`
+		ScheduledDate string            `json:"scheduled_date,omitempty"`
 	}
 
 	newVmChange := NewVmChangeRequest{
 		Options: NewVmChangeOption{},
 	}
+	var err error
+	newVmChange.ScheduledDate, err = scheduledDate(controlPanel.ApplyChangesAt)
+	if err != nil {
+		return nil, err
+	}
 	productCode, licenseType := splitControlPanelProductID(controlPanel.ProductID)
 	if productCode == "CP_DIRECTADMIN" { // @hardcoded
 		newVmChange.Options.DirectAdminLicense = licenseType
 	} else { // CP_PLESK
 		newVmChange.Options.PleskLicense = licenseType
-	}
-	for _, extension := range controlPanel.Extensions {
-		switch extension.ID {
-		case "plesk_extension_dnssec":
-			newVmChange.Options.PleskDnssec = 1
-		case "plesk_extension_hosting_pack":
-			newVmChange.Options.PleskHostingPack = 1
-		case "plesk_extension_powerpack":
-			newVmChange.Options.PleskPowerPack = 1
-		case "plesk_extension_language_pack":
-			newVmChange.Options.PleskLanguagePack = 1
+		newVmChange.Options.PleskDnssec = new(int)
+		newVmChange.Options.PleskHostingPack = new(int)
+		newVmChange.Options.PleskPowerPack = new(int)
+		newVmChange.Options.PleskLanguagePack = new(int)
+		for _, extension := range controlPanel.Extensions {
+			switch extension.ID {
+			case "plesk_extension_dnssec":
+				*newVmChange.Options.PleskDnssec = 1
+			case "plesk_extension_hosting_pack":
+				*newVmChange.Options.PleskHostingPack = 1
+			case "plesk_extension_powerpack":
+				*newVmChange.Options.PleskPowerPack = 1
+			case "plesk_extension_language_pack":
+				*newVmChange.Options.PleskLanguagePack = 1
+			}
 		}
 	}
 
@@ -327,7 +360,7 @@ func (c *Client) UpdateControlPanel(orderID int64, controlPanel ControlPanel) (*
 		return nil, err
 	}
 	// change request
-	reqChange, err := http.NewRequest("PUT", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, strconv.FormatInt(orderID, 10)), strings.NewReader(string(rb)))
+	reqChange, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, strconv.FormatInt(orderID, 10)), strings.NewReader(string(rb)))
 	if err != nil {
 		return nil, err
 	}
@@ -343,65 +376,50 @@ func (c *Client) UpdateControlPanel(orderID int64, controlPanel ControlPanel) (*
 		return nil, err
 	}
 
+	var changeResult changeRequestResult
+	err = json.Unmarshal(resChange, &changeResult)
+	if err != nil {
+		return nil, err
+	}
+	// scheduled changes are applied later, in the maintenance window
+	if newVmChange.ScheduledDate == "" {
+		if err := c.waitForChangeRequest(ctx, strconv.FormatInt(orderID, 10), changeResult.ChangeRequestID); err != nil {
+			return nil, err
+		}
+	}
+
 	return &controlPanelOrder, nil
 }
 
-// DeleteControlPanel - Deletes a control panel
-func (c *Client) DeleteControlPanel(orderID int64) error {
-	// obtain VM uuid
-	reqOrder, err := http.NewRequest("GET", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, strconv.FormatInt(orderID, 10)), nil)
+// DeleteControlPanel - Ends the order of a control panel as the policy says, returns its end date
+func (c *Client) DeleteControlPanel(ctx context.Context, orderID int64, policy DeletionPolicy) (string, error) {
+	// obtain billed until
+	reqOrder, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, strconv.FormatInt(orderID, 10)), nil)
 	if err != nil {
-		return err
+		return "", err
 	}
 	bodyOrder, err := c.doRequest(reqOrder)
 	if err != nil {
-		return err
+		return "", err
 	}
 	var orderData NewVmOrderWrapper
 	err = json.Unmarshal(bodyOrder, &orderData)
 	if err != nil {
-		return err
+		return "", err
 	}
-	log.Printf("Obtained Billed until: %s", orderData.Order.BilledUntil)
+	tflog.Debug(ctx, "Obtained billed until", map[string]any{"billed_until": orderData.Order.BilledUntil})
 
 	// set end date for order
-	type NewVmOrderEnd struct {
-		EndDate          string `json:"end_date"`
-		IncludeSubOrders bool   `json:"includeSubOrders,omitempty"`
-	}
-	endDate, err := time.Parse("2006-01-02T15:04:05.000Z07:00", orderData.Order.BilledUntil) // this is the format for RFC3339 including milliseconds
-	if err != nil {
-		panic(err)
+	if policy == DeletionPolicyStopOnly {
+		return "", fmt.Errorf("deletion policy %q is not supported for control panels", policy)
 	}
-	timezone, err := time.LoadLocation("Europe/Amsterdam")
+	endDate, err := c.orderEndDate(orderData.Order.BilledUntil, policy)
 	if err != nil {
-		panic(err)
-	}
-	newVmOrderEnd := NewVmOrderEnd{
-		EndDate:          endDate.In(timezone).Format("2006-01-02"), // this is the format for YYYY-MM-DD
-		IncludeSubOrders: true,
-	}
-	reqBodyOrderEnd, err := json.Marshal(newVmOrderEnd)
-	if err != nil {
-		return err
-	}
-	reqOrderEnd, err := http.NewRequest("PUT", fmt.Sprintf("%s/account/v1/order/%s/enddate", c.HostURL, strconv.FormatInt(orderID, 10)), strings.NewReader(string(reqBodyOrderEnd)))
-	if err != nil {
-		return err
+		return "", err
 	}
-	resBodyOrderEnd, err := c.doRequest(reqOrderEnd)
-	if err != nil {
-		return err
+	if err := c.setOrderEndDate(ctx, strconv.FormatInt(orderID, 10), endDate); err != nil {
+		return "", err
 	}
 
-	if strings.ReplaceAll(string(resBodyOrderEnd), " ", "") != "{\"success\":true}" {
-		return errors.New(string(resBodyOrderEnd))
-	}
-	log.Printf("Set end date for order %s", strconv.FormatInt(orderID, 10))
-
-	// @todo also delete sub orders
-	// @todo also delete sub orders
-	// @todo also delete sub orders
-
-	return nil
+	return endDate, nil
 }
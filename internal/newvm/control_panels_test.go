@@ -0,0 +1,34 @@
+package newvm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestGetControlPanelProducts(t *testing.T) {
+	client := newReplayClient(t, "control_panel_products")
+
+	controlPanelProducts, err := client.GetControlPanelProducts(context.Background())
+	if err != nil {
+		t.Fatalf("GetControlPanelProducts: %v", err)
+	}
+
+	pleskExtensions := []ControlPanelExtension{
+		{ID: "plesk_extension_dnssec", Description: "DNSSEC", Price: 2},
+		{ID: "plesk_extension_powerpack", Description: "Power Pack", Price: 6.5},
+	}
+	expected := []ControlPanelProduct{
+		// product IDs use the enum index, which need not be contiguous
+		{ID: "CP_DIRECTADMIN.da_license.1", Type: "personal_plus", Description: "DirectAdmin: Personal Plus (15 domains)", Price: 5.95, Extensions: []ControlPanelExtension{}},
+		{ID: "CP_DIRECTADMIN.da_license.2", Type: "lite", Description: "DirectAdmin: Lite (50 domains)", Price: 15, Extensions: []ControlPanelExtension{}},
+		{ID: "CP_DIRECTADMIN.da_license.4", Type: "standard", Description: "DirectAdmin: Standard (unlimited)", Price: 29, Extensions: []ControlPanelExtension{}},
+		// only flag options are extensions, quantities are not
+		{ID: "CP_PLESK.plesk_12_license.0", Type: "web_admin", Description: "Plesk Obsidian: Web Admin Edition", Price: 10.5, Extensions: pleskExtensions},
+		{ID: "CP_PLESK.plesk_12_license.1", Type: "web_pro", Description: "Plesk Obsidian: Web Pro Edition", Price: 17.5, Extensions: pleskExtensions},
+		{ID: "CP_PLESK.plesk_12_license.2", Type: "web_host", Description: "Plesk Obsidian: Web Host Edition", Price: 30.5, Extensions: pleskExtensions},
+	}
+	if !reflect.DeepEqual(controlPanelProducts, expected) {
+		t.Fatalf("unexpected control panel products:\n got: %+v\nwant: %+v", controlPanelProducts, expected)
+	}
+}
@@ -0,0 +1,118 @@
+package newvm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata" // billing timezones must not depend on the system zone database
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// DefaultBillingTimezone - Timezone the billing periods of NewVM orders end in
+const DefaultBillingTimezone = "Europe/Amsterdam"
+
+// DeletionPolicy - How an order is ended when its resource is deleted
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyEndOfBillingPeriod - End the order on the last day it is billed for
+	DeletionPolicyEndOfBillingPeriod DeletionPolicy = "end_of_billing_period"
+	// DeletionPolicyImmediate - End the order today
+	DeletionPolicyImmediate DeletionPolicy = "immediate"
+	// DeletionPolicyStopOnly - Stop the VM, but keep the order running
+	DeletionPolicyStopOnly DeletionPolicy = "stop_only"
+)
+
+// ChildOrdersError - Error of a VM that is not deleted because it has running child orders
+type ChildOrdersError struct {
+	OrderID     int
+	ChildOrders []NewVmOrder
+}
+
+func (e *ChildOrdersError) Error() string {
+	childOrders := make([]string, len(e.ChildOrders))
+	for i, childOrder := range e.ChildOrders {
+		childOrders[i] = fmt.Sprintf("%d (%s)", childOrder.ID, childOrder.ProductID)
+	}
+	return fmt.Sprintf("order %d has running child orders: %s", e.OrderID, strings.Join(childOrders, ", "))
+}
+
+// WithBillingTimezone - Sets the timezone end dates of orders are calculated in
+func WithBillingTimezone(timezone *time.Location) ClientOption {
+	return func(c *Client) {
+		c.billingTimezone = timezone
+	}
+}
+
+// orderEndDate returns the date an order billed until billedUntil ends on
+// with the given policy, empty when the order is not ended.
+func (c *Client) orderEndDate(billedUntil string, policy DeletionPolicy) (string, error) {
+	switch policy {
+	case DeletionPolicyStopOnly:
+		return "", nil
+	case DeletionPolicyImmediate:
+		return time.Now().In(c.billingTimezone).Format(time.DateOnly), nil
+	case DeletionPolicyEndOfBillingPeriod, "":
+		endDate, err := time.Parse(time.RFC3339, billedUntil)
+		if err != nil {
+			return "", fmt.Errorf("unable to parse billed until %q: %w", billedUntil, err)
+		}
+		return endDate.In(c.billingTimezone).Format(time.DateOnly), nil
+	default:
+		return "", fmt.Errorf("unknown deletion policy %q", policy)
+	}
+}
+
+// runningChildOrders returns the orders placed under orderID that do not
+// have an end date yet.
+func (c *Client) runningChildOrders(ctx context.Context, orderID int) ([]NewVmOrder, error) {
+	orders, err := c.GetAllOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var childOrders []NewVmOrder
+	for _, order := range orders {
+		if order.ParentID == orderID && order.EndDate == "" {
+			childOrders = append(childOrders, order)
+		}
+	}
+	tflog.Debug(ctx, "Obtained running child orders", map[string]any{"order_id": orderID, "child_orders": len(childOrders)})
+	return childOrders, nil
+}
+
+// setOrderEndDate ends the order and its sub orders on endDate (YYYY-MM-DD).
+func (c *Client) setOrderEndDate(ctx context.Context, orderID string, endDate string) error {
+	type NewVmOrderEnd struct {
+		EndDate          string `json:"end_date"`
+		IncludeSubOrders bool   `json:"includeSubOrders,omitempty"`
+	}
+	newVmOrderEnd := NewVmOrderEnd{
+		EndDate:          endDate,
+		IncludeSubOrders: true,
+	}
+	reqBodyOrderEnd, err := json.Marshal(newVmOrderEnd)
+	if err != nil {
+		return err
+	}
+	// setting the same end date again is harmless, so the request may be replayed
+	reqOrderEnd, err := http.NewRequestWithContext(withRetrySafe(ctx), "PUT", fmt.Sprintf("%s/account/v1/order/%s/enddate", c.HostURL, orderID), strings.NewReader(string(reqBodyOrderEnd)))
+	if err != nil {
+		return err
+	}
+	resBodyOrderEnd, err := c.doRequest(reqOrderEnd)
+	if err != nil {
+		return err
+	}
+
+	if strings.ReplaceAll(string(resBodyOrderEnd), " ", "") != "{\"success\":true}" {
+		return errors.New(string(resBodyOrderEnd))
+	}
+	tflog.Debug(ctx, "Set end date for order", map[string]any{"order_id": orderID, "end_date": endDate})
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package newvm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+)
+
+func TestDeleteVmPolicies(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+
+	tests := []struct {
+		policy  newvm.DeletionPolicy
+		endDate func(order newvmtest.Order) string
+	}{
+		{
+			// billing periods end at midnight UTC, which is the day before in New York
+			policy:  newvm.DeletionPolicyEndOfBillingPeriod,
+			endDate: func(order newvmtest.Order) string { return order.BilledUntil.In(newYork).Format(time.DateOnly) },
+		},
+		{
+			policy:  newvm.DeletionPolicyImmediate,
+			endDate: func(newvmtest.Order) string { return time.Now().In(newYork).Format(time.DateOnly) },
+		},
+		{
+			policy:  newvm.DeletionPolicyStopOnly,
+			endDate: func(newvmtest.Order) string { return "" },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			ctx := context.Background()
+			s := newvmtest.NewServer(t)
+			client := newFakeClient(t, s, newvm.WithBillingTimezone(newYork))
+			orderID := createTestVm(t, client)
+			vm, err := client.WaitForVm(ctx, orderID)
+			if err != nil {
+				t.Fatalf("WaitForVm: %v", err)
+			}
+
+			endDate, err := client.DeleteVm(ctx, orderID, test.policy, false)
+			if err != nil {
+				t.Fatalf("DeleteVm: %v", err)
+			}
+
+			order, _ := s.Order(vm.OrderID)
+			if want := test.endDate(order); endDate != want || order.EndDate != want {
+				t.Fatalf("expected end date %q, got %q and %q on the order", want, endDate, order.EndDate)
+			}
+			if order.VmStatus != "STOPPED" {
+				t.Fatalf("expected the VM to be stopped, got %q", order.VmStatus)
+			}
+
+			vm, err = client.GetVm(ctx, orderID)
+			if err != nil {
+				t.Fatalf("GetVm: %v", err)
+			}
+			if vm.EndDate != order.EndDate {
+				t.Fatalf("expected GetVm to report end date %q, got %q", order.EndDate, vm.EndDate)
+			}
+		})
+	}
+}
+
+func TestDeleteControlPanelStopOnly(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	vm, err := client.CreateVm(ctx, newvm.Vm{VmProductID: "VM-A1", Os: "debian-12", Hostname: "cp.example.com"})
+	if err != nil {
+		t.Fatalf("CreateVm: %v", err)
+	}
+	controlPanel, err := client.CreateControlPanel(ctx, newvm.ControlPanel{VmID: vm.OrderID, ProductID: "CP_PLESK.plesk_12_license.1"})
+	if err != nil {
+		t.Fatalf("CreateControlPanel: %v", err)
+	}
+
+	if _, err := client.DeleteControlPanel(ctx, int64(controlPanel.ID), newvm.DeletionPolicyStopOnly); err == nil {
+		t.Fatal("expected stop_only to be rejected for control panels")
+	}
+	if order, _ := s.Order(controlPanel.ID); order.EndDate != "" {
+		t.Fatalf("expected the control panel order to keep running, got end date %q", order.EndDate)
+	}
+}
+
+func TestDeleteMissingOrder(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient(t, newvmtest.NewServer(t))
+
+	// callers rely on IsNotFound to drop orders removed outside of Terraform
+	if _, err := client.DeleteVm(ctx, "1234", newvm.DeletionPolicyEndOfBillingPeriod, false); !newvm.IsNotFound(err) {
+		t.Fatalf("DeleteVm: expected a not found error, got %v", err)
+	}
+	if _, err := client.DeleteControlPanel(ctx, 1234, newvm.DeletionPolicyEndOfBillingPeriod); !newvm.IsNotFound(err) {
+		t.Fatalf("DeleteControlPanel: expected a not found error, got %v", err)
+	}
+}
+
+func TestDeleteVmChildOrders(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+	vm, err := client.WaitForVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("WaitForVm: %v", err)
+	}
+	controlPanel, err := client.CreateControlPanel(ctx, newvm.ControlPanel{VmID: vm.OrderID, ProductID: "CP_PLESK.plesk_12_license.1"})
+	if err != nil {
+		t.Fatalf("CreateControlPanel: %v", err)
+	}
+
+	// without endChildOrders the VM is left untouched
+	_, err = client.DeleteVm(ctx, orderID, newvm.DeletionPolicyImmediate, false)
+	var childErr *newvm.ChildOrdersError
+	if !errors.As(err, &childErr) || childErr.OrderID != vm.OrderID || len(childErr.ChildOrders) != 1 || childErr.ChildOrders[0].ID != controlPanel.ID {
+		t.Fatalf("expected a child orders error for control panel %d, got %v", controlPanel.ID, err)
+	}
+	if order, _ := s.Order(vm.OrderID); order.EndDate != "" || order.VmStatus != newvm.VmStatusRunning {
+		t.Fatalf("expected the VM to keep running, got %+v", order)
+	}
+
+	endDate, err := client.DeleteVm(ctx, orderID, newvm.DeletionPolicyImmediate, true)
+	if err != nil {
+		t.Fatalf("DeleteVm: %v", err)
+	}
+	if order, _ := s.Order(controlPanel.ID); order.EndDate != endDate {
+		t.Fatalf("expected the control panel to end on %s with the VM, got %q", endDate, order.EndDate)
+	}
+}
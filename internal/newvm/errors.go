@@ -0,0 +1,96 @@
+package newvm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError - Error response returned by the NewVM API
+type APIError struct {
+	StatusCode int    // HTTP status code of the response
+	Code       string // API error code, if the API returned one
+	Message    string // API error message, falls back to the raw response body
+	Method     string // HTTP method of the failed request
+	Path       string // URL path of the failed request
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if e.Code != "" {
+		msg = e.Code + ": " + msg
+	}
+	return fmt.Sprintf("%s %s: status %d: %s", e.Method, e.Path, e.StatusCode, msg)
+}
+
+// IsPromoCodeRejection - Reports whether err is an API error for an order that was rejected because of its promo codes.
+// The API has no dedicated error code for it, so a client error that mentions a promo code is taken as one.
+func IsPromoCodeRejection(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode < http.StatusBadRequest || apiErr.StatusCode >= http.StatusInternalServerError {
+		return false
+	}
+	return strings.Contains(strings.ToLower(apiErr.Code+" "+apiErr.Message), "promo")
+}
+
+// IsNotFound - Reports whether err is an API error for a resource that does not exist (anymore)
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusGone
+}
+
+// newAPIError builds an APIError from a non-200 API response. The API
+// reports errors as {"error": "..."}, {"code": "...", "message": "..."} or
+// {"error": {"code": "...", "message": "..."}}; anything else is kept as is.
+func newAPIError(req *http.Request, statusCode int, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Message:    string(body),
+		Method:     req.Method,
+		Path:       req.URL.Path,
+	}
+
+	type errorDetails struct {
+		Code    json.RawMessage `json:"code"`
+		Message string          `json:"message"`
+	}
+	var payload struct {
+		errorDetails
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return apiErr
+	}
+
+	details := payload.errorDetails
+	if len(payload.Error) > 0 {
+		var message string
+		var nested errorDetails
+		if err := json.Unmarshal(payload.Error, &message); err == nil {
+			details.Message = message
+		} else if err := json.Unmarshal(payload.Error, &nested); err == nil {
+			details = nested
+		}
+	}
+
+	if details.Message != "" {
+		apiErr.Message = details.Message
+	}
+	if len(details.Code) > 0 {
+		var code string
+		if err := json.Unmarshal(details.Code, &code); err != nil {
+			code = string(details.Code) // numeric codes
+		}
+		apiErr.Code = code
+	}
+
+	return apiErr
+}
@@ -1,6 +1,7 @@
 package newvm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,11 +11,16 @@ type NewVmLocationsWrapper struct {
 	Locations []Location `json:"locations"`
 }
 
-// GetLocations - Returns all operating systems
-func (c *Client) GetLocations() ([]Location, error) {
+// GetLocations - Returns all provisionable locations
+func (c *Client) GetLocations(ctx context.Context) ([]Location, error) {
+	return c.locations.get(ctx, c.catalogTTL, c.now, c.fetchLocations)
+}
+
+// fetchLocations requests all locations from the API, bypassing the cache
+func (c *Client) fetchLocations(ctx context.Context) ([]Location, error) {
 	locations := []Location{}
 	// obtain operating systems
-	reqLocations, err := http.NewRequest("GET", fmt.Sprintf("%s/backend/com.newvm.network/v1/location", c.HostURL), nil)
+	reqLocations, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/backend/com.newvm.network/v1/location", c.HostURL), nil)
 	if err != nil {
 		return nil, err
 	}
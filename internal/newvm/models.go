@@ -6,6 +6,11 @@ type ControlPanel struct {
 	VmID       int                     `json:"vm_id,omitempty"`
 	ProductID  string                  `json:"product,omitempty"` /* eg. CP_PLESK.plesk_12_license.1 */
 	Extensions []ControlPanelExtension `json:"extensions,omitempty"`
+	PromoCodes []string                `json:"promoCodes,omitempty"` /* only sent when ordering */
+
+	ApplyChangesAt  string `json:"-"` /* RFC 3339 time to schedule change requests at, empty applies them right away */
+	PendingChangeAt string `json:"-"` /* scheduled date of the pending change request */
+	EndDate         string `json:"-"` /* date the order ends (YYYY-MM-DD), empty while it runs */
 }
 
 // Control Panel extension
@@ -107,14 +112,22 @@ type NewVmOrder struct {
 	Options             []NewVmOption            `json:"options"`
 	ProvisioningOptions NewVmProvisioningOptions `json:"prov_options"`
 	ProvisioningData    NewVmProvisioningData    `json:"prov_data"`
+	CustomDescription   string                   `json:"custom_description,omitempty"`
 	BilledUntil         string                   `json:"billed_until,omitempty"`
+	EndDate             string                   `json:"end_date,omitempty"`
+	Reference           string                   `json:"reference,omitempty"`
 	NeedsChange         int                      `json:"needs_change,omitempty"`
+	ProvisioningError   string                   `json:"provisionerror,omitempty"`
 }
 
 type NewVmOrderWrapper struct {
 	Order NewVmOrder `json:"order"`
 }
 
+type NewVmOrdersWrapper struct {
+	Orders []NewVmOrder `json:"result"`
+}
+
 // NewVM pricing option
 type NewVmPricing struct {
 	Type   int32 `json:"vm_type,omitempty"`
@@ -199,30 +212,38 @@ type Product struct {
 
 // VM
 type Vm struct {
-	ID                   string  `json:"id"`
-	OrderID              int     `json:"order_id,omitempty"`
-	VmProductID          string  `json:"product,omitempty"` /* eg. VM-A2 or VM-B5 */
-	Os                   string  `json:"os,omitempty"`
-	Hostname             string  `json:"hostname,omitempty"`
-	Status               string  `json:"status"`
-	VmName               string  `json:"vmname"`
-	Location             string  `json:"location,omitempty"`
-	Ram                  int64   `json:"ram"`
-	Reserved             int64   `json:"reserved"`
-	Cores                int     `json:"cores"`
-	HdSize               int64   `json:"hdsize"`
-	BiosGuid             string  `json:"biosGuid,omitempty"`
-	IsSecureBootEnabled  bool    `json:"isSecureBootEnabled"`
-	SecureBootTemplateId string  `json:"secureBootTemplateId,omitempty"`
-	Firmware             string  `json:"firmware"`
-	SshKey               string  `json:"sshkey,omitempty"`
-	IsVpcOnly            bool    `json:"isVpcOnly,omitempty"`
-	UseDhcp              bool    `json:"useDhcp,omitempty"`
-	Vpc                  []int32 `json:"vpc,omitempty"`
-	IpAddress            string  `json:"ipaddress,omitempty"`
-	SubnetMask           string  `json:"subnetmask,omitempty"`
-	Gateway              string  `json:"gateway,omitempty"`
-	DnsServer            string  `json:"dnsserver,omitempty"`
+	ID                   string   `json:"id"`
+	OrderID              int      `json:"order_id,omitempty"`
+	VmProductID          string   `json:"product,omitempty"` /* eg. VM-A2 or VM-B5 */
+	Os                   string   `json:"os,omitempty"`
+	Hostname             string   `json:"hostname,omitempty"`
+	Status               string   `json:"status"`
+	VmName               string   `json:"vmname"`
+	Location             string   `json:"location,omitempty"`
+	Ram                  int64    `json:"ram"`
+	Reserved             int64    `json:"reserved"`
+	Cores                int      `json:"cores"`
+	HdSize               int64    `json:"hdsize"`
+	BiosGuid             string   `json:"biosGuid,omitempty"`
+	IsSecureBootEnabled  bool     `json:"isSecureBootEnabled"`
+	SecureBootTemplateId string   `json:"secureBootTemplateId,omitempty"`
+	Firmware             string   `json:"firmware"`
+	SshKey               string   `json:"sshkey,omitempty"`
+	IsVpcOnly            bool     `json:"isVpcOnly,omitempty"`
+	UseDhcp              bool     `json:"useDhcp,omitempty"`
+	Vpc                  []int32  `json:"vpc,omitempty"`
+	IpAddress            string   `json:"ipaddress,omitempty"`
+	SubnetMask           string   `json:"subnetmask,omitempty"`
+	Gateway              string   `json:"gateway,omitempty"`
+	DnsServer            string   `json:"dnsserver,omitempty"`
+	Comments             string   `json:"comments,omitempty"`
+	Description          string   `json:"custom_description,omitempty"`
+	PromoCodes           []string `json:"promoCodes,omitempty"` /* only sent when ordering */
+	Reference            string   `json:"-"`                    /* client reference the order was placed with */
+
+	ApplyChangesAt  string `json:"-"` /* RFC 3339 time to schedule change requests at, empty applies them right away */
+	PendingChangeAt string `json:"-"` /* scheduled date of the pending change request */
+	EndDate         string `json:"-"` /* date the order ends (YYYY-MM-DD), empty while it runs */
 }
 
 // VM product
@@ -1,6 +1,7 @@
 package newvm
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,11 +9,12 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// GetAllOrders - Returns all user's order
-func (c *Client) GetAllOrders() (*[]Order, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/orders", c.HostURL), nil)
+// GetAllOrders - Returns all orders of the account
+func (c *Client) GetAllOrders(ctx context.Context) ([]NewVmOrder, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/order", c.HostURL), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -22,18 +24,23 @@ func (c *Client) GetAllOrders() (*[]Order, error) {
 		return nil, err
 	}
 
-	orders := []Order{}
-	err = json.Unmarshal(body, &orders)
+	ordersData := NewVmOrdersWrapper{}
+	err = json.Unmarshal(body, &ordersData)
 	if err != nil {
 		return nil, err
 	}
 
-	return &orders, nil
+	return ordersData.Orders, nil
 }
 
-// GetOrder - Returns a specifc order
-func (c *Client) GetOrder(orderID string) (*Order, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/account/v1/customer/self/order/%s", c.HostURL, orderID), nil)
+// BilledUntilTime - Returns the end of the period the order is billed for
+func (o NewVmOrder) BilledUntilTime() (time.Time, error) {
+	return time.Parse(time.RFC3339, o.BilledUntil)
+}
+
+// GetOrder - Returns a specific order
+func (c *Client) GetOrder(ctx context.Context, orderID string) (*NewVmOrder, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, orderID), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -43,13 +50,13 @@ func (c *Client) GetOrder(orderID string) (*Order, error) {
 		return nil, err
 	}
 
-	order := Order{}
-	err = json.Unmarshal(body, &order)
+	orderData := NewVmOrderWrapper{}
+	err = json.Unmarshal(body, &orderData)
 	if err != nil {
 		return nil, err
 	}
 
-	return &order, nil
+	return &orderData.Order, nil
 }
 
 func RandomString(n int) string {
@@ -63,7 +70,7 @@ func RandomString(n int) string {
 }
 
 // CreateOrder - Create new orr
-func (c *Client) CreateOrder(orderItems []OrderItem, comments string) (*Order, error) {
+func (c *Client) CreateOrder(ctx context.Context, orderItems []OrderItem, comments string) (*Order, error) {
 	// Order @NewVM Order structure
 	type NewVmOrderOption struct {
 		VmCore      int `json:"vm_core,omitempty"`
@@ -127,7 +134,7 @@ func (c *Client) CreateOrder(orderItems []OrderItem, comments string) (*Order, e
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/account/v1/customer/self/order", c.HostURL), strings.NewReader(string(rb)))
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/account/v1/customer/self/order", c.HostURL), strings.NewReader(string(rb)))
 	if err != nil {
 		return nil, err
 	}
@@ -147,13 +154,13 @@ func (c *Client) CreateOrder(orderItems []OrderItem, comments string) (*Order, e
 }
 
 // UpdateOrder - Updates an order
-func (c *Client) UpdateOrder(orderID string, orderItems []OrderItem) (*Order, error) {
+func (c *Client) UpdateOrder(ctx context.Context, orderID string, orderItems []OrderItem) (*Order, error) {
 	rb, err := json.Marshal(orderItems)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/orders/%s", c.HostURL, orderID), strings.NewReader(string(rb)))
+	req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%s/orders/%s", c.HostURL, orderID), strings.NewReader(string(rb)))
 	if err != nil {
 		return nil, err
 	}
@@ -173,8 +180,8 @@ func (c *Client) UpdateOrder(orderID string, orderItems []OrderItem) (*Order, er
 }
 
 // DeleteOrder - Deletes an order
-func (c *Client) DeleteOrder(orderID string) error {
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/orders/%s", c.HostURL, orderID), nil)
+func (c *Client) DeleteOrder(ctx context.Context, orderID string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/orders/%s", c.HostURL, orderID), nil)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,36 @@
+package newvm_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"unithost-terraform/internal/newvmtest"
+)
+
+func TestGetOrders(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+
+	orders, err := client.GetAllOrders(ctx)
+	if err != nil {
+		t.Fatalf("GetAllOrders: %v", err)
+	}
+	if len(orders) != 1 || strconv.Itoa(orders[0].ID) != orderID || orders[0].ProductID != "VM-A" {
+		t.Fatalf("expected the VM order, got %+v", orders)
+	}
+
+	order, err := client.GetOrder(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	stored, _ := s.Order(order.ID)
+	if order.ProvisioningData.VmUuid != stored.VmUUID || order.BilledUntil == "" || order.NeedsChange != 0 {
+		t.Fatalf("expected the order as stored, got %+v for %+v", order, stored)
+	}
+	if _, err := client.GetOrder(ctx, "999999"); err == nil {
+		t.Fatal("expected an error for an unknown order")
+	}
+}
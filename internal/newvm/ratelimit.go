@@ -0,0 +1,57 @@
+package newvm
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// WithRateLimit - Limits the client to requestsPerSecond on average, allowing bursts of up to burst requests
+func WithRateLimit(requestsPerSecond float64, burst int) ClientOption {
+	return func(c *Client) {
+		if requestsPerSecond <= 0 {
+			c.limiter = nil
+			return
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		c.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
+	}
+}
+
+// WithMaxConcurrency - Limits the number of API requests the client has in flight at the same time
+func WithMaxConcurrency(maxConcurrent int) ClientOption {
+	return func(c *Client) {
+		if maxConcurrent <= 0 {
+			c.slots = nil
+			return
+		}
+		c.slots = make(chan struct{}, maxConcurrent)
+	}
+}
+
+// acquire blocks until the request may be sent under the configured
+// concurrency and rate limits. The returned function releases the
+// concurrency slot and must be called once the response has been read.
+func (c *Client) acquire(ctx context.Context) (func(), error) {
+	release := func() {}
+
+	if c.slots != nil {
+		select {
+		case c.slots <- struct{}{}:
+			release = func() { <-c.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	return release, nil
+}
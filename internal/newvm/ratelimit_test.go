@@ -0,0 +1,125 @@
+package newvm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrencyUnderParallelRequests(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	attempts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		attempts[r.URL.Path]++
+		first := attempts[r.URL.Path] == 1
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		// every request fails once, so its slot is released and taken again for the retry
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "{}")
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(ctx, &server.URL, nil, nil, nil,
+		WithMaxConcurrency(2),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/request/%d", server.URL, i), nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			_, errs[i] = c.doRequest(req)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("doRequest: %v", err)
+	}
+	if maxInFlight > 2 {
+		t.Fatalf("expected at most 2 requests in flight, got %d", maxInFlight)
+	}
+	if len(c.slots) != 0 {
+		t.Fatalf("expected all slots to be released, %d are taken", len(c.slots))
+	}
+}
+
+func TestAcquireHonoursContext(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClient(ctx, nil, nil, nil, nil, WithMaxConcurrency(1))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	release, err := c.acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	// waiting for the taken slot ends with the context
+	cancelled, cancel := context.WithCancel(ctx)
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := c.acquire(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the wait for a slot to be cancelled, got %v", err)
+	}
+
+	release()
+	release, err = c.acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	release()
+}
+
+func TestAcquireReleasesSlotWhenRateLimited(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClient(ctx, nil, nil, nil, nil, WithMaxConcurrency(1), WithRateLimit(0.001, 1))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	// the burst is used up, the next request would have to wait far beyond the deadline
+	release, err := c.acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	release()
+
+	deadline, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.acquire(deadline); err == nil {
+		t.Fatal("expected the rate limited wait to fail")
+	}
+	if len(c.slots) != 0 {
+		t.Fatal("expected the slot to be released when the rate limit wait fails")
+	}
+}
@@ -0,0 +1,113 @@
+package newvm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// NewReference - Returns a random client reference to order a VM with. Every resource gets its own, so an order
+// found by its reference can only be the one that resource placed.
+func NewReference() string {
+	random := make([]byte, 8)
+	_, _ = rand.Read(random) // never fails
+	return "tf-" + hex.EncodeToString(random)
+}
+
+// AmbiguousReferenceError - Error of a VM that is not ordered because several running orders were placed with its
+// reference, so it is unknown which one belongs to it
+type AmbiguousReferenceError struct {
+	Reference string
+	Orders    []NewVmOrder
+}
+
+func (e *AmbiguousReferenceError) Error() string {
+	orders := make([]string, len(e.Orders))
+	for i, order := range e.Orders {
+		orders[i] = fmt.Sprintf("%d", order.ID)
+	}
+	return fmt.Sprintf("orders %s were all placed with reference %s", strings.Join(orders, ", "), e.Reference)
+}
+
+// OrderNotConfirmedError - Error of a VM order that may have been placed, but could not be looked up by its reference
+// afterwards. The order is looked up again by Reference.
+type OrderNotConfirmedError struct {
+	Reference string
+	Err       error // error of the order request
+}
+
+func (e *OrderNotConfirmedError) Error() string {
+	return fmt.Sprintf("could not confirm whether the order with reference %s was placed: %s", e.Reference, e.Err)
+}
+
+func (e *OrderNotConfirmedError) Unwrap() error {
+	return e.Err
+}
+
+// GetOrderByReference - Returns the running order that was placed with reference, nil when there is none. More than
+// one is an *AmbiguousReferenceError.
+func (c *Client) GetOrderByReference(ctx context.Context, reference string) (*NewVmOrder, error) {
+	orders, err := c.GetAllOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found []NewVmOrder
+	for _, order := range orders {
+		if order.Reference == reference && order.EndDate == "" {
+			tflog.Debug(ctx, "Found order by reference", map[string]any{"order_id": order.ID, "reference": reference})
+			found = append(found, order)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &found[0], nil
+	default:
+		return nil, &AmbiguousReferenceError{Reference: reference, Orders: found}
+	}
+}
+
+// confirmOrder looks up the order placed with reference after the order request failed with orderErr. A rejected
+// request placed nothing. Otherwise the lookup is repeated until it succeeds or ctx is done, as the API may not be
+// reachable right after the failure; when it never succeeds an *OrderNotConfirmedError is returned.
+func (c *Client) confirmOrder(ctx context.Context, reference string, orderErr error) (*NewVmOrder, error) {
+	var apiErr *APIError
+	if errors.As(orderErr, &apiErr) && apiErr.StatusCode >= http.StatusBadRequest && apiErr.StatusCode < http.StatusInternalServerError {
+		return nil, orderErr
+	}
+
+	var order *NewVmOrder
+	var lookupErr error
+	err := c.poll(ctx, func(ctx context.Context) (bool, error) {
+		order, lookupErr = c.GetOrderByReference(ctx, reference)
+		var referenceErr *AmbiguousReferenceError
+		if errors.As(lookupErr, &referenceErr) {
+			return false, lookupErr
+		}
+		if lookupErr != nil {
+			tflog.Warn(ctx, "Could not look up the order by reference", map[string]any{"reference": reference, "error": lookupErr.Error()})
+			return false, nil
+		}
+		return true, nil
+	}, func() string {
+		return fmt.Sprintf("order with reference %s could not be looked up: %s", reference, lookupErr)
+	})
+	if err != nil {
+		var referenceErr *AmbiguousReferenceError
+		if errors.As(err, &referenceErr) {
+			return nil, err
+		}
+		return nil, &OrderNotConfirmedError{Reference: reference, Err: orderErr}
+	}
+	if order == nil {
+		return nil, orderErr
+	}
+	return order, nil
+}
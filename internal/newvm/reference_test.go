@@ -0,0 +1,119 @@
+package newvm_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+)
+
+func countOrders(s *newvmtest.Server) int {
+	orders := 0
+	for _, request := range s.Requests() {
+		if strings.HasPrefix(request, "POST /account/v1/customer/self/order/") {
+			orders++
+		}
+	}
+	return orders
+}
+
+func TestCreateVmAdoptsOrderWithSameReference(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	s.LoseOrderResponses(1)
+	client := newFakeClient(t, s)
+	vm := newvm.Vm{VmProductID: "VM-A2", Os: "debian-12", Hostname: "web1.example.com", UseDhcp: true, Reference: newvm.NewReference()}
+
+	// the order is placed, but its response is lost
+	placed, err := client.CreateVm(ctx, vm)
+	if err != nil {
+		t.Fatalf("CreateVm: %v", err)
+	}
+	if order, _ := s.Order(placed.OrderID); order.Reference != vm.Reference {
+		t.Fatalf("expected the order with reference %s, got %+v", vm.Reference, order)
+	}
+
+	// a later apply adopts the order, even though its VM runs by now
+	adopted, err := newFakeClient(t, s).CreateVm(ctx, vm)
+	if err != nil {
+		t.Fatalf("CreateVm: %v", err)
+	}
+	if adopted.OrderID != placed.OrderID {
+		t.Fatalf("expected order %d to be adopted, got %+v", placed.OrderID, adopted)
+	}
+	if orders := countOrders(s); orders != 1 {
+		t.Fatalf("expected the VM to be ordered once, got %d orders", orders)
+	}
+}
+
+func TestCreateVmNewReference(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	vm := newvm.Vm{VmProductID: "VM-A2", Os: "debian-12", Hostname: "web.example.com", UseDhcp: true}
+
+	// identical VMs under count, or a VM created again after a stop_only
+	// destroy, each have a reference of their own
+	var orderIDs []int
+	for range 2 {
+		vm.Reference = newvm.NewReference()
+		created, err := client.CreateVm(ctx, vm)
+		if err != nil {
+			t.Fatalf("CreateVm: %v", err)
+		}
+		if _, err := client.DeleteVm(ctx, strconv.Itoa(created.OrderID), newvm.DeletionPolicyStopOnly, false); err != nil {
+			t.Fatalf("DeleteVm: %v", err)
+		}
+		orderIDs = append(orderIDs, created.OrderID)
+	}
+	if orderIDs[0] == orderIDs[1] {
+		t.Fatalf("expected an order per reference, both got order %d", orderIDs[0])
+	}
+}
+
+func TestCreateVmOrderNotConfirmed(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	s.LoseOrderResponses(1)
+	s.FailOrderListsAfterLostOrders(true)
+	client := newFakeClient(t, s, newvm.WithRetryPolicy(newvm.RetryPolicy{MaxAttempts: 1}))
+	vm := newvm.Vm{VmProductID: "VM-A2", Os: "debian-12", Hostname: "web1.example.com", UseDhcp: true, Reference: newvm.NewReference()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := client.CreateVm(ctx, vm)
+	var notConfirmedErr *newvm.OrderNotConfirmedError
+	if !errors.As(err, &notConfirmedErr) || notConfirmedErr.Reference != vm.Reference {
+		t.Fatalf("expected an OrderNotConfirmedError for reference %s, got %v", vm.Reference, err)
+	}
+
+	// once the API is back, the order is found by its reference
+	s.FailOrderListsAfterLostOrders(false)
+	order, err := client.GetOrderByReference(context.Background(), vm.Reference)
+	if err != nil {
+		t.Fatalf("GetOrderByReference: %v", err)
+	}
+	if order == nil {
+		t.Fatal("expected the placed order to be found")
+	}
+}
+
+func TestCreateVmRejectedOrder(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	vm := newvm.Vm{VmProductID: "VM-A2", Os: "debian-12", Hostname: "web1.example.com", UseDhcp: true, Reference: newvm.NewReference(), PromoCodes: []string{"NOSUCHCODE"}}
+
+	// a rejected order placed nothing, there is nothing to look up
+	if _, err := client.CreateVm(ctx, vm); err == nil {
+		t.Fatal("expected the rejected order to fail CreateVm")
+	}
+	requests := s.Requests()
+	if last := requests[len(requests)-1]; !strings.HasPrefix(last, "POST /account/v1/customer/self/order/") {
+		t.Fatalf("expected no requests after the rejected order, got %s", last)
+	}
+}
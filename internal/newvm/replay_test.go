@@ -0,0 +1,209 @@
+package newvm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Replay fixtures are recorded API responses in testdata/replay. Tests run
+// against them offline; set NEWVM_RECORD=1 together with NEWVM_HOST,
+// NEWVM_USERNAME and NEWVM_PASSWORD to refresh them from the real API.
+
+// replayHost is the host of clients replaying fixtures, it is never contacted.
+const replayHost = "https://api.newvm.invalid"
+
+// unrecordedPaths are requests that are not recorded, as they only exist
+// to set up the session.
+var unrecordedPaths = []string{"/identity/v1", "/account/v1/token"}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+// replayFixture is the file format of a replay fixture.
+type replayFixture struct {
+	Interactions []replayInteraction `json:"interactions"`
+}
+
+type replayInteraction struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Query  string          `json:"query,omitempty"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"` // JSON response body
+	Text   string          `json:"text,omitempty"` // any other response body
+}
+
+// replayTransport serves the interactions of a fixture in recorded order,
+// or records them from the real API in recording mode.
+type replayTransport struct {
+	t         testing.TB
+	file      string
+	recording bool
+	next      http.RoundTripper
+
+	mu      sync.Mutex
+	fixture replayFixture
+	served  int
+}
+
+// newReplayClient returns a client serving the responses of the named
+// fixture, or recording them when NEWVM_RECORD is set.
+func newReplayClient(t *testing.T, name string) *Client {
+	t.Helper()
+
+	transport := &replayTransport{
+		t:    t,
+		file: filepath.Join("testdata", "replay", name+".json"),
+	}
+	ctx := context.Background()
+
+	if os.Getenv("NEWVM_RECORD") != "" {
+		host, username, password := os.Getenv("NEWVM_HOST"), os.Getenv("NEWVM_USERNAME"), os.Getenv("NEWVM_PASSWORD")
+		if host == "" || username == "" || password == "" {
+			t.Skip("recording requires NEWVM_HOST, NEWVM_USERNAME and NEWVM_PASSWORD")
+		}
+		transport.recording = true
+		transport.next = http.DefaultTransport
+		t.Cleanup(transport.save)
+
+		client, err := NewClient(ctx, &host, &username, &password, nil,
+			WithHTTPClient(&http.Client{Transport: transport}),
+			WithCatalogTTL(0),
+		)
+		if err != nil {
+			t.Fatalf("unable to log in for recording: %v", err)
+		}
+		return client
+	}
+
+	raw, err := os.ReadFile(transport.file)
+	if err != nil {
+		t.Fatalf("unable to read fixture: %v", err)
+	}
+	if err := json.Unmarshal(raw, &transport.fixture); err != nil {
+		t.Fatalf("invalid fixture %s: %v", transport.file, err)
+	}
+	t.Cleanup(transport.verify)
+
+	host := replayHost
+	client, err := NewClient(ctx, &host, nil, nil, nil,
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+		WithCatalogTTL(0),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func (rt *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt.recording {
+		return rt.record(req)
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.served >= len(rt.fixture.Interactions) {
+		return nil, fmt.Errorf("replay %s: unexpected request %s %s, all %d recorded requests were served", rt.file, req.Method, req.URL.RequestURI(), rt.served)
+	}
+	interaction := rt.fixture.Interactions[rt.served]
+	if interaction.Method != req.Method || interaction.Path != req.URL.Path || interaction.Query != req.URL.RawQuery {
+		return nil, fmt.Errorf("replay %s: request %d is %s %s, but %s %s?%s was recorded", rt.file, rt.served+1, req.Method, req.URL.RequestURI(), interaction.Method, interaction.Path, interaction.Query)
+	}
+	rt.served++
+
+	body := []byte(interaction.Text)
+	if len(interaction.Body) > 0 {
+		body = interaction.Body
+	}
+
+	return &http.Response{
+		StatusCode: interaction.Status,
+		Status:     fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// record forwards the request to the API and keeps a sanitised copy of the response.
+func (rt *replayTransport) record(req *http.Request) (*http.Response, error) {
+	res, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range unrecordedPaths {
+		if strings.HasSuffix(req.URL.Path, path) {
+			return res, nil
+		}
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := replayInteraction{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.RawQuery,
+		Status: res.StatusCode,
+	}
+	sanitised := emailPattern.ReplaceAllString(redactBody(body), "user@example.com")
+	if json.Valid([]byte(sanitised)) {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, []byte(sanitised), "", "  "); err != nil {
+			return nil, err
+		}
+		interaction.Body = indented.Bytes()
+	} else {
+		interaction.Text = sanitised
+	}
+
+	rt.mu.Lock()
+	rt.fixture.Interactions = append(rt.fixture.Interactions, interaction)
+	rt.mu.Unlock()
+
+	return res, nil
+}
+
+// save writes the recorded interactions to the fixture file.
+func (rt *replayTransport) save() {
+	raw, err := json.MarshalIndent(rt.fixture, "", "  ")
+	if err != nil {
+		rt.t.Errorf("unable to encode fixture: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(rt.file), 0o755); err != nil {
+		rt.t.Errorf("unable to write fixture: %v", err)
+		return
+	}
+	if err := os.WriteFile(rt.file, append(raw, '\n'), 0o644); err != nil {
+		rt.t.Errorf("unable to write fixture: %v", err)
+	}
+}
+
+// verify fails the test when recorded requests were not made, which means
+// the client no longer makes the requests the fixture was recorded for.
+func (rt *replayTransport) verify() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.served < len(rt.fixture.Interactions) {
+		next := rt.fixture.Interactions[rt.served]
+		rt.t.Errorf("replay %s: only %d of %d recorded requests were made, next is %s %s", rt.file, rt.served, len(rt.fixture.Interactions), next.Method, next.Path)
+	}
+}
@@ -0,0 +1,125 @@
+package newvm
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy - Controls how transient API failures are retried
+type RetryPolicy struct {
+	MaxAttempts int           // total number of attempts, including the first one
+	MinBackoff  time.Duration // wait before the first retry
+	MaxBackoff  time.Duration // upper bound for the exponential backoff
+}
+
+// DefaultRetryPolicy - Retry policy used when none is configured
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  1 * time.Second,
+	MaxBackoff:  30 * time.Second,
+}
+
+type retrySafeKey struct{}
+
+// withRetrySafe marks requests made with the returned context as safe to
+// replay, even when their HTTP verb is not idempotent.
+func withRetrySafe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retrySafeKey{}, true)
+}
+
+// isRetrySafe reports whether req may be sent again after a failed attempt.
+// PUT is not idempotent on this API: PUT /account/v1/order/{id} places a
+// change request, so a replay would queue a duplicate one.
+func isRetrySafe(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete:
+		return true
+	}
+	safe, _ := req.Context().Value(retrySafeKey{}).(bool)
+	return safe
+}
+
+// shouldRetry decides whether a request is retried after the given response
+// or transport error. A 429 or a failure to connect means the API never
+// processed the request, so those are retried regardless of the HTTP verb.
+func shouldRetry(req *http.Request, res *http.Response, err error) bool {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return true
+		}
+		return isRetrySafe(req)
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return isRetrySafe(req)
+	}
+	return false
+}
+
+// backoff returns the wait before the given retry attempt (1-based). A
+// Retry-After header on the response takes precedence over the exponential
+// backoff, which uses equal jitter to spread out concurrent retries.
+func (p RetryPolicy) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if wait, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+			return wait
+		}
+	}
+
+	wait := p.MinBackoff
+	for i := 1; i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
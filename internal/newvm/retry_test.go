@@ -0,0 +1,38 @@
+package newvm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestShouldRetryGatewayErrors(t *testing.T) {
+	ctx := context.Background()
+	res := &http.Response{StatusCode: http.StatusBadGateway}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		method   string
+		expected bool
+	}{
+		{name: "GET", ctx: ctx, method: http.MethodGet, expected: true},
+		{name: "DELETE", ctx: ctx, method: http.MethodDelete, expected: true},
+		// PUT /account/v1/order/{id} places a change request, a replay would queue it twice
+		{name: "PUT", ctx: ctx, method: http.MethodPut, expected: false},
+		{name: "POST", ctx: ctx, method: http.MethodPost, expected: false},
+		{name: "PUT marked retry safe", ctx: withRetrySafe(ctx), method: http.MethodPut, expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(test.ctx, test.method, "https://api.newvm.com/account/v1/order/1001", nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			if retry := shouldRetry(req, res, nil); retry != test.expected {
+				t.Fatalf("expected retry %t after a 502, got %t", test.expected, retry)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package newvm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrTotpReused - The session expired, but the configured TOTP code was already used to log in
+var ErrTotpReused = errors.New("the NewVM session expired and the configured TOTP code has already been used; " +
+	"provide a new TOTP code and run again, or configure a TOTP secret to generate codes automatically")
+
+type skipReauthKey struct{}
+
+// withoutReauthentication disables the automatic session refresh for
+// requests made with the returned context, eg. for the login itself.
+func withoutReauthentication(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipReauthKey{}, true)
+}
+
+// isUnauthorized reports whether err is an API error for an invalid or expired token.
+func isUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// canReauthenticate reports whether the client can log in again on behalf of req.
+func (c *Client) canReauthenticate(req *http.Request) bool {
+	if skip, _ := req.Context().Value(skipReauthKey{}).(bool); skip {
+		return false
+	}
+	return c.Auth.Username != "" && c.Auth.Password != ""
+}
+
+// reauthenticate replaces the expired staleToken with a new session. Only
+// one refresh runs at a time; requests that failed with the same stale
+// token while a refresh was in progress reuse its result instead of logging
+// in again.
+func (c *Client) reauthenticate(ctx context.Context, staleToken string) error {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+
+	if c.currentToken() != staleToken {
+		return nil
+	}
+	if c.Auth.Totp != "" && c.totpUsed && c.totpSecret == "" {
+		return ErrTotpReused
+	}
+
+	ar, err := c.Login(ctx)
+	if err != nil {
+		return err
+	}
+	c.setToken(ar.Token)
+
+	if err := c.verifyToken(ctx); err != nil {
+		return err
+	}
+	c.storeCachedToken(ctx)
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package newvm_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+)
+
+// countRequests returns how often request ("METHOD /path") was received.
+func countRequests(s *newvmtest.Server, request string) int {
+	count := 0
+	for _, received := range s.Requests() {
+		if received == request {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDoRequestReplaysAfterLogin(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+	s.ExpireTokens()
+
+	before := len(s.Requests())
+	if _, err := client.GetOrder(ctx, orderID); err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+
+	// the expired request, the login, the token check and the replay
+	expected := []string{
+		"GET /account/v1/order/" + orderID,
+		"POST /identity/v1",
+		"GET /account/v1/token",
+		"GET /account/v1/order/" + orderID,
+	}
+	if requests := s.Requests()[before:]; !slices.Equal(requests, expected) {
+		t.Fatalf("expected requests %v, got %v", expected, requests)
+	}
+}
+
+func TestDoRequestReplaysBody(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	s.ExpireTokens()
+
+	// the fake API rejects a VPC without label, so an empty replayed body fails
+	created, err := client.CreateVpc(ctx, newvm.Vpc{Name: "backend"})
+	if err != nil {
+		t.Fatalf("CreateVpc: %v", err)
+	}
+	if creates := countRequests(s, "POST /backend/com.newvm.network/v1/vxlan"); creates != 2 {
+		t.Fatalf("expected the VPC request to be replayed once, got %d requests", creates)
+	}
+	vpc, err := client.GetVpc(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetVpc: %v", err)
+	}
+	if vpc.Name != "backend" {
+		t.Fatalf("expected the replayed VPC to be named backend, got %q", vpc.Name)
+	}
+}
+
+func TestDoRequestLogsInOnceForConcurrentRequests(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+	s.ExpireTokens()
+
+	logins := countRequests(s, "POST /identity/v1")
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = client.GetOrder(ctx, orderID)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if logins := countRequests(s, "POST /identity/v1") - logins; logins != 1 {
+		t.Fatalf("expected one login for all expired requests, got %d", logins)
+	}
+}
+
+func TestDoRequestReportsUnauthorizedReplay(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+	s.UnauthorizeRequests("GET /account/v1/order/" + orderID)
+
+	// a new session that is refused as well is reported, not refreshed again
+	_, err := client.GetOrder(ctx, orderID)
+	var apiErr *newvm.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the 401 of the replay, got %v", err)
+	}
+	if reads := countRequests(s, "GET /account/v1/order/"+orderID); reads != 2 {
+		t.Fatalf("expected the request and a single replay, got %d requests", reads)
+	}
+	if logins := countRequests(s, "POST /identity/v1"); logins != 2 {
+		t.Fatalf("expected a single login after the first one, got %d logins", logins)
+	}
+}
@@ -0,0 +1,208 @@
+package newvm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// DefaultSessionLifetime - Assumed lifetime of a session token that does not carry its own expiry
+const DefaultSessionLifetime = 1 * time.Hour
+
+// tokenExpiryMargin keeps cached tokens from being used right before they expire.
+const tokenExpiryMargin = 2 * time.Minute
+
+// TokenCache - Stores session tokens on disk, so consecutive Terraform runs can skip the login
+type TokenCache struct {
+	Dir string
+}
+
+// cachedToken is the file format of a cached session token.
+type cachedToken struct {
+	Host     string    `json:"host"`
+	Username string    `json:"username"`
+	Token    string    `json:"token"`
+	Expires  time.Time `json:"expires"`
+}
+
+// NewTokenCache - Returns a token cache in dir, or in the user's cache directory when dir is empty
+func NewTokenCache(dir string) (*TokenCache, error) {
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine the user cache directory: %w", err)
+		}
+		dir = filepath.Join(userCacheDir, "terraform-provider-newvm")
+	}
+
+	return &TokenCache{Dir: dir}, nil
+}
+
+// WithTokenCache - Reuses session tokens from cache instead of logging in, and stores new ones in it
+func WithTokenCache(cache *TokenCache) ClientOption {
+	return func(c *Client) {
+		c.tokenCache = cache
+	}
+}
+
+// Load - Returns the cached token for host and username, if there is one that has not expired
+func (tc *TokenCache) Load(host, username string) (string, error) {
+	file := tc.path(host, username)
+
+	info, err := os.Stat(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("ignoring token cache file %s, it is accessible by other users (mode %s)", file, info.Mode().Perm())
+	}
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	var cached cachedToken
+	if err := json.Unmarshal(raw, &cached); err != nil {
+		return "", fmt.Errorf("invalid token cache file %s: %w", file, err)
+	}
+
+	// guard against hash collisions and files copied between keys
+	if cached.Host != host || cached.Username != username {
+		return "", nil
+	}
+	if time.Now().Add(tokenExpiryMargin).After(cached.Expires) {
+		return "", nil
+	}
+
+	return cached.Token, nil
+}
+
+// Store - Saves the token for host and username, readable by the current user only
+func (tc *TokenCache) Store(host, username, token string) error {
+	if err := os.MkdirAll(tc.Dir, 0o700); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(cachedToken{
+		Host:     host,
+		Username: username,
+		Token:    token,
+		Expires:  tokenExpiry(token, time.Now()),
+	})
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so concurrent runs never read half a file
+	tmp, err := os.CreateTemp(tc.Dir, ".token-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), tc.path(host, username))
+}
+
+// Remove - Deletes the cached token for host and username
+func (tc *TokenCache) Remove(host, username string) error {
+	err := os.Remove(tc.path(host, username))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (tc *TokenCache) path(host, username string) string {
+	key := sha256.Sum256([]byte(strings.TrimRight(host, "/") + "\x00" + username))
+	return filepath.Join(tc.Dir, hex.EncodeToString(key[:])+".json")
+}
+
+// tokenExpiry returns when token expires. JWTs carry their own expiry,
+// other tokens are assumed to last DefaultSessionLifetime from now.
+func tokenExpiry(token string, now time.Time) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 {
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err == nil {
+			var claims struct {
+				Expires int64 `json:"exp"`
+			}
+			if json.Unmarshal(payload, &claims) == nil && claims.Expires > 0 {
+				return time.Unix(claims.Expires, 0)
+			}
+		}
+	}
+
+	return now.Add(DefaultSessionLifetime)
+}
+
+// loadCachedToken tries to resume the session from the token cache. It
+// reports whether a cached token was accepted by the API.
+func (c *Client) loadCachedToken(ctx context.Context) (bool, error) {
+	token, err := c.tokenCache.Load(c.HostURL, c.Auth.Username)
+	if err != nil {
+		tflog.Warn(ctx, "Unable to read NewVM token cache", map[string]any{"error": err.Error()})
+		return false, nil
+	}
+	if token == "" {
+		return false, nil
+	}
+
+	c.setToken(token)
+	err = c.verifyToken(ctx)
+	if isUnauthorized(err) {
+		tflog.Debug(ctx, "Cached NewVM session token was rejected, logging in")
+		c.setToken("")
+		// remove it right away, the login that follows may fail as well
+		if err := c.tokenCache.Remove(c.HostURL, c.Auth.Username); err != nil {
+			tflog.Warn(ctx, "Unable to remove rejected token from NewVM token cache", map[string]any{"error": err.Error()})
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// the configured TOTP code logged in the earlier run, it cannot be used again
+	if c.Auth.Totp != "" {
+		c.totpUsed = true
+	}
+
+	tflog.Debug(ctx, "Resumed NewVM session from token cache")
+	return true, nil
+}
+
+// storeCachedToken saves the current session token, if a token cache is configured.
+func (c *Client) storeCachedToken(ctx context.Context) {
+	if c.tokenCache == nil {
+		return
+	}
+	if err := c.tokenCache.Store(c.HostURL, c.Auth.Username, c.currentToken()); err != nil {
+		tflog.Warn(ctx, "Unable to write NewVM token cache", map[string]any{"error": err.Error()})
+	}
+}
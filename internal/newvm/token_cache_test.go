@@ -0,0 +1,63 @@
+package newvm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+)
+
+func TestTokenCacheRemovesRejectedToken(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	cache := &newvm.TokenCache{Dir: t.TempDir()}
+	if err := cache.Store(s.URL, s.Username, "token-revoked"); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	// the fallback login fails too, the rejected token must not be tried again next run
+	password := "wrong"
+	_, err := newvm.NewClient(context.Background(), &s.URL, &s.Username, &password, nil,
+		newvm.WithTokenCache(cache),
+		newvm.WithRetryPolicy(newvm.RetryPolicy{MaxAttempts: 1}),
+	)
+	if err == nil {
+		t.Fatal("expected login to fail")
+	}
+
+	token, err := cache.Load(s.URL, s.Username)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if token != "" {
+		t.Fatalf("expected the rejected token to be removed from the cache, got %q", token)
+	}
+}
+
+func TestTokenCacheResumedSessionDoesNotReuseTotp(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	cache := &newvm.TokenCache{Dir: t.TempDir()}
+	totp := "123456"
+
+	// the first run logs in with the TOTP code and caches the session
+	if _, err := newvm.NewClient(ctx, &s.URL, &s.Username, &s.Password, &totp, newvm.WithTokenCache(cache)); err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	// the next run with the same code resumes the session, until it expires
+	client, err := newvm.NewClient(ctx, &s.URL, &s.Username, &s.Password, &totp, newvm.WithTokenCache(cache))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	s.ExpireTokens()
+	logins := countRequests(s, "POST /identity/v1")
+
+	if _, err := client.GetAllOrders(ctx); !errors.Is(err, newvm.ErrTotpReused) {
+		t.Fatalf("expected ErrTotpReused, got %v", err)
+	}
+	if countRequests(s, "POST /identity/v1") != logins {
+		t.Fatal("expected no login with the used TOTP code")
+	}
+}
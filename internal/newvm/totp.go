@@ -0,0 +1,100 @@
+package newvm
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// TotpPeriod - Time step of the TOTP codes accepted by the NewVM API
+const TotpPeriod = 30 * time.Second
+
+// totpDigits is the number of digits in a TOTP code.
+const totpDigits = 6
+
+// WithTotpSecret - Generates the TOTP code for every login from a shared secret
+func WithTotpSecret(secret string) ClientOption {
+	return func(c *Client) {
+		c.totpSecret = secret
+	}
+}
+
+// GenerateTotp - Returns the RFC 6238 code (HMAC-SHA1, 30 seconds, 6 digits) for a base32 encoded secret at time t
+func GenerateTotp(secret string, t time.Time) (string, error) {
+	key, err := decodeTotpSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return totpCode(key, totpStep(t)), nil
+}
+
+// decodeTotpSecret decodes a base32 secret as shown by authenticator apps,
+// which may be lower case, grouped with spaces and lack padding.
+func decodeTotpSecret(secret string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(secret))
+	normalized = strings.TrimRight(normalized, "=")
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP secret, expected a base32 encoded value: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("invalid TOTP secret, the value is empty")
+	}
+
+	return key, nil
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(TotpPeriod/time.Second)
+}
+
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation, see RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo)
+}
+
+// nextTotp generates the code for the next login. A code is accepted only
+// once, so when the current time step was already used by an earlier login
+// this waits for the next time step.
+func (c *Client) nextTotp(ctx context.Context) (string, error) {
+	key, err := decodeTotpSecret(c.totpSecret)
+	if err != nil {
+		return "", err
+	}
+
+	step := totpStep(c.now())
+	if step <= c.lastTotpStep {
+		step = c.lastTotpStep + 1
+		wait := time.Unix(step*int64(TotpPeriod/time.Second), 0).Sub(c.now())
+		tflog.Debug(ctx, "Waiting for the next TOTP time step", map[string]any{"wait": wait.String()})
+		if err := sleepContext(ctx, wait); err != nil {
+			return "", err
+		}
+	}
+	c.lastTotpStep = step
+
+	return totpCode(key, step), nil
+}
@@ -0,0 +1,84 @@
+package newvm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890" in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateTotp(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, truncated to the 6 digits NewVM accepts
+	for unix, expected := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		code, err := GenerateTotp(rfc6238Secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("GenerateTotp: %v", err)
+		}
+		if code != expected {
+			t.Errorf("expected code %s at %d, got %s", expected, unix, code)
+		}
+	}
+}
+
+func TestGenerateTotpNormalizesSecret(t *testing.T) {
+	code, err := GenerateTotp("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("GenerateTotp: %v", err)
+	}
+	if code != "287082" {
+		t.Fatalf("expected code 287082, got %s", code)
+	}
+
+	if _, err := GenerateTotp("not base32!", time.Now()); err == nil {
+		t.Fatal("expected an error for an invalid secret")
+	}
+}
+
+func TestNextTotpWaitsForNextStep(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClient(ctx, nil, nil, nil, nil, WithTotpSecret(rfc6238Secret))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	// 10ms before the second time step ends
+	c.now = func() time.Time { return time.Unix(59, 990*int64(time.Millisecond)) }
+
+	first, err := c.nextTotp(ctx)
+	if err != nil {
+		t.Fatalf("nextTotp: %v", err)
+	}
+	if first != "287082" {
+		t.Fatalf("expected the code of the current time step, got %s", first)
+	}
+
+	// a second login in the same time step must not reuse the code
+	started := time.Now()
+	second, err := c.nextTotp(ctx)
+	if err != nil {
+		t.Fatalf("nextTotp: %v", err)
+	}
+	expected, _ := GenerateTotp(rfc6238Secret, time.Unix(60, 0))
+	if second != expected {
+		t.Fatalf("expected the code of the next time step %s, got %s", expected, second)
+	}
+	if waited := time.Since(started); waited < 10*time.Millisecond {
+		t.Fatalf("expected to wait for the next time step, waited %s", waited)
+	}
+
+	// the time step after that is 30 seconds away
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.nextTotp(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the wait to end with the context, got %v", err)
+	}
+}
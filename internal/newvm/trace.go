@@ -0,0 +1,128 @@
+package newvm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// subsystemAPI is the tflog subsystem tracing every API request. Its level
+// can be set separately with the TF_LOG_PROVIDER_NEWVM_API environment variable.
+const subsystemAPI = "api"
+
+// redactedValue replaces secrets in traced request and response bodies.
+const redactedValue = "***"
+
+// sensitiveKeys are the JSON keys whose values never end up in the logs.
+var sensitiveKeys = map[string]struct{}{
+	"password":    {},
+	"totp":        {},
+	"vm_password": {},
+	"token":       {},
+	"da_admin":    {},
+}
+
+// maskedFieldKeys are the log fields whose values never end up in the
+// logs. Masks of the root logger do not apply to a subsystem, so root fields
+// holding credentials are masked here again.
+var maskedFieldKeys = []string{"x_auth_token", "newvm_password", "newvm_token"}
+
+// newTraceContext adds the API subsystem logger to ctx, with the
+// authentication token masked in all its output.
+func newTraceContext(ctx context.Context) context.Context {
+	ctx = tflog.NewSubsystem(ctx, subsystemAPI,
+		tflog.WithLevelFromEnv("TF_LOG_PROVIDER_NEWVM_API"),
+		tflog.WithRootFields(),
+	)
+	return tflog.SubsystemMaskFieldValuesWithFieldKeys(ctx, subsystemAPI, maskedFieldKeys...)
+}
+
+// traceRequestBody returns a redacted copy of the request body for tracing,
+// without consuming the body that is about to be sent.
+func traceRequestBody(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return ""
+	}
+	return redactBody(raw)
+}
+
+// traceResponse logs a single API request attempt at trace level.
+func traceResponse(ctx context.Context, req *http.Request, res *http.Response, err error, attempt int, started time.Time, requestBody string, responseBody []byte) {
+	fields := map[string]any{
+		"method":       req.Method,
+		"path":         req.URL.Path,
+		"query":        req.URL.RawQuery,
+		"attempt":      attempt,
+		"duration_ms":  time.Since(started).Milliseconds(),
+		"x_auth_token": req.Header.Get("X-Auth-Token"),
+	}
+	if requestBody != "" {
+		fields["request_body"] = requestBody
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	if res != nil {
+		fields["status"] = res.StatusCode
+		if requestID := res.Header.Get("X-Request-Id"); requestID != "" {
+			fields["request_id"] = requestID
+		}
+	}
+	if responseBody != nil {
+		fields["response_body"] = redactBody(responseBody)
+	}
+
+	tflog.SubsystemTrace(ctx, subsystemAPI, "NewVM API request", fields)
+}
+
+// redactBody masks the values of sensitive keys in a JSON body. Bodies that
+// are not JSON are logged as is, as the API only uses JSON for credentials.
+func redactBody(raw []byte) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var body any
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return string(raw)
+	}
+
+	redacted, err := json.Marshal(redactValue(body))
+	if err != nil {
+		return string(raw)
+	}
+	return string(redacted)
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, nested := range v {
+			if _, ok := sensitiveKeys[strings.ToLower(key)]; ok {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = redactValue(nested)
+		}
+	case []any:
+		for i, nested := range v {
+			v[i] = redactValue(nested)
+		}
+	}
+	return value
+}
@@ -0,0 +1,45 @@
+package newvm_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+)
+
+func TestTraceMasksCredentials(t *testing.T) {
+	t.Setenv("TF_LOG_PROVIDER_NEWVM_API", "TRACE")
+	s := newvmtest.NewServer(t)
+	apiToken := "api-token-secret"
+
+	// the API subsystem copies the root fields, but not the masks of the root logger
+	var output bytes.Buffer
+	ctx := tflogtest.RootLogger(context.Background(), &output)
+	ctx = tflog.SetField(ctx, "newvm_password", s.Password)
+	ctx = tflog.SetField(ctx, "newvm_token", apiToken)
+	ctx = tflog.MaskFieldValuesWithFieldKeys(ctx, "newvm_password", "newvm_token")
+
+	client, err := newvm.NewClient(ctx, &s.URL, &s.Username, &s.Password, nil)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := client.GetVpcs(ctx); err != nil {
+		t.Fatalf("GetVpcs: %v", err)
+	}
+
+	logs := output.String()
+	if !strings.Contains(logs, "NewVM API request") {
+		t.Fatalf("expected the API requests to be traced, got:\n%s", logs)
+	}
+	for _, secret := range []string{s.Password, apiToken, client.Token} {
+		if strings.Contains(logs, secret) {
+			t.Fatalf("expected %q to be masked, got:\n%s", secret, logs)
+		}
+	}
+}
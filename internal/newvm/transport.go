@@ -0,0 +1,87 @@
+package newvm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// DefaultRequestTimeout - Time limit for a single API request, order creation can take a while
+const DefaultRequestTimeout = 60 * time.Second
+
+// TransportConfig - HTTP transport settings for the API client
+type TransportConfig struct {
+	Timeout            time.Duration // time limit per request, DefaultRequestTimeout when zero
+	ProxyURL           string        // proxy for all requests, HTTPS_PROXY and friends are used when empty
+	CACertFile         string        // PEM bundle of extra CA certificates to trust
+	ClientCertFile     string        // PEM client certificate for mutual TLS
+	ClientKeyFile      string        // PEM private key of ClientCertFile
+	InsecureSkipVerify bool          // skip verification of the server certificate
+}
+
+// WithHTTPClient - Uses httpClient for all API requests
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// NewHTTPClient - Returns an HTTP client for the NewVM API configured from cfg
+func NewHTTPClient(cfg TransportConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", cfg.ProxyURL, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM encoded certificates found in CA bundle %s", cfg.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+			return nil, fmt.Errorf("a client certificate requires both a certificate and a key file")
+		}
+		certificate, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}, nil
+}
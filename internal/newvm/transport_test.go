@@ -0,0 +1,122 @@
+package newvm_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"unithost-terraform/internal/newvm"
+)
+
+// writeFile writes content to a file in a temporary directory and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return file
+}
+
+func TestNewHTTPClientErrors(t *testing.T) {
+	notPem := writeFile(t, "ca.txt", "not a certificate")
+
+	tests := []struct {
+		name     string
+		cfg      newvm.TransportConfig
+		expected string
+	}{
+		{name: "unreadable CA file", cfg: newvm.TransportConfig{CACertFile: filepath.Join(t.TempDir(), "missing.pem")}, expected: "unable to read CA bundle"},
+		{name: "CA file without certificates", cfg: newvm.TransportConfig{CACertFile: notPem}, expected: "no PEM encoded certificates"},
+		{name: "bad proxy URL", cfg: newvm.TransportConfig{ProxyURL: "http://[::1"}, expected: "invalid proxy URL"},
+		{name: "client certificate without key", cfg: newvm.TransportConfig{ClientCertFile: notPem}, expected: "requires both a certificate and a key file"},
+		{name: "invalid client certificate", cfg: newvm.TransportConfig{ClientCertFile: notPem, ClientKeyFile: notPem}, expected: "unable to load client certificate"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newvm.NewHTTPClient(test.cfg)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientServerCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	t.Cleanup(server.Close)
+	caFile := writeFile(t, "ca.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+
+	tests := []struct {
+		name    string
+		cfg     newvm.TransportConfig
+		trusted bool
+	}{
+		{name: "system CAs", cfg: newvm.TransportConfig{}, trusted: false},
+		{name: "custom CA", cfg: newvm.TransportConfig{CACertFile: caFile}, trusted: true},
+		{name: "insecure", cfg: newvm.TransportConfig{InsecureSkipVerify: true}, trusted: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			httpClient, err := newvm.NewHTTPClient(test.cfg)
+			if err != nil {
+				t.Fatalf("NewHTTPClient: %v", err)
+			}
+			res, err := httpClient.Get(server.URL)
+			if err == nil {
+				res.Body.Close()
+			}
+			if trusted := err == nil; trusted != test.trusted {
+				t.Fatalf("expected the server to be trusted %t, got error %v", test.trusted, err)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	t.Cleanup(proxy.Close)
+
+	httpClient, err := newvm.NewHTTPClient(newvm.TransportConfig{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("NewHTTPClient: %v", err)
+	}
+	res, err := httpClient.Get("http://api.newvm.invalid/account/v1/token")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	res.Body.Close()
+
+	if proxied != "http://api.newvm.invalid/account/v1/token" {
+		t.Fatalf("expected the request to go through the proxy, got %q", proxied)
+	}
+}
+
+func TestNewHTTPClientTimeout(t *testing.T) {
+	for _, test := range []struct {
+		timeout  time.Duration
+		expected time.Duration
+	}{
+		{timeout: 0, expected: newvm.DefaultRequestTimeout},
+		{timeout: 5 * time.Second, expected: 5 * time.Second},
+	} {
+		httpClient, err := newvm.NewHTTPClient(newvm.TransportConfig{Timeout: test.timeout})
+		if err != nil {
+			t.Fatalf("NewHTTPClient: %v", err)
+		}
+		if httpClient.Timeout != test.expected {
+			t.Fatalf("expected timeout %s for %s, got %s", test.expected, test.timeout, httpClient.Timeout)
+		}
+	}
+}
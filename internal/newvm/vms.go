@@ -1,18 +1,18 @@
 package newvm
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
+	"maps"
 	"net/http"
-	"reflect"
+	"slices"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/hashicorp/terraform-plugin-framework/attr"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
 type NewVmVmWrapper struct {
@@ -20,7 +20,7 @@ type NewVmVmWrapper struct {
 }
 
 // GetVms - Returns list of available VM products (no auth required)
-func (c *Client) GetVmProducts() ([]VmProduct, error) {
+func (c *Client) GetVmProducts(ctx context.Context) ([]VmProduct, error) {
 	vmProducts := []VmProduct{}
 
 	type IntermediateProduct struct {
@@ -38,7 +38,7 @@ func (c *Client) GetVmProducts() ([]VmProduct, error) {
 	intermediates := []IntermediateProduct{}
 
 	// first we obtain all 'VM-A' products @hardcoded product ID
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/account/v1/product/VM-A", c.HostURL), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/product/VM-A", c.HostURL), nil)
 	if err != nil {
 		return nil, err
 	} else {
@@ -57,13 +57,13 @@ func (c *Client) GetVmProducts() ([]VmProduct, error) {
 	}
 
 	// and then we add all Vm-B products @hardcoded product ID
-	req, err = http.NewRequest("GET", fmt.Sprintf("%s/account/v1/product/VM-B", c.HostURL), nil)
+	req, err = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/product/VM-B", c.HostURL), nil)
 	if err != nil {
 		return nil, err
 	} else {
 		body, err := c.doRequest(req)
 		if err != nil {
-			log.Printf("Error during request: %v\n", err)
+			tflog.Warn(ctx, "Error during request", map[string]any{"error": err.Error()})
 			//return nil, err
 		} else {
 			intermediateProductVmB := IntermediateProduct{}
@@ -102,20 +102,20 @@ func (c *Client) GetVmProducts() ([]VmProduct, error) {
 						if optionProperty.PropertyID == ramPropertyID && optionProperty.PricingID == "vm_type" && optionProperty.Index == enumOption.Index {
 							ram, err = strconv.ParseInt(optionProperty.Value, 10, 64)
 							if err != nil {
-								fmt.Println("Conversion error:", err)
+								tflog.Error(ctx, "Conversion error", map[string]any{"error": err.Error()})
 								return []VmProduct{}, err
 							}
 						} else if optionProperty.PropertyID == coresPropertyID && optionProperty.PricingID == "vm_type" && optionProperty.Index == enumOption.Index {
 							c, err := strconv.ParseInt(optionProperty.Value, 10, 32)
 							if err != nil {
-								fmt.Println("Conversion error:", err)
+								tflog.Error(ctx, "Conversion error", map[string]any{"error": err.Error()})
 								return []VmProduct{}, err
 							}
 							cores = int32(c)
 						} else if optionProperty.PropertyID == hdSizePropertyID && optionProperty.PricingID == "vm_type" && optionProperty.Index == enumOption.Index {
 							hdSize, err = strconv.ParseInt(optionProperty.Value, 10, 64)
 							if err != nil {
-								fmt.Println("Conversion error:", err)
+								tflog.Error(ctx, "Conversion error", map[string]any{"error": err.Error()})
 								return []VmProduct{}, err
 							}
 						}
@@ -138,11 +138,11 @@ func (c *Client) GetVmProducts() ([]VmProduct, error) {
 }
 
 // GetVm - Returns specific vm details
-func (c *Client) GetVm(orderID string) (*Vm, error) {
+func (c *Client) GetVm(ctx context.Context, orderID string) (*Vm, error) {
 	if orderID != "" {
 		// combine data from various API paths
 		// first obtain the order details
-		reqOrder, err := http.NewRequest("GET", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, orderID), nil)
+		reqOrder, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, orderID), nil)
 		if err != nil {
 			return nil, err
 		}
@@ -174,8 +174,9 @@ func (c *Client) GetVm(orderID string) (*Vm, error) {
 		}
 
 		// merge outstanding change requests with the order details if any
+		pendingChangeAt := ""
 		if orderData.Order.NeedsChange == 1 {
-			reqChanges, err := http.NewRequest("GET", fmt.Sprintf("%s/account/v1/order/changerequest?orderId=%s", c.HostURL, orderID), nil)
+			reqChanges, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/order/changerequest?orderId=%s", c.HostURL, orderID), nil)
 			if err != nil {
 				return nil, err
 			}
@@ -188,58 +189,33 @@ func (c *Client) GetVm(orderID string) (*Vm, error) {
 			if err != nil {
 				return nil, err
 			}
-			changeRequest := changesData.Changes[0]
-			newOptions := NewVmPricing{}
-			if err := json.Unmarshal([]byte(changeRequest.NewOptions), &newOptions); err != nil {
-				panic(err)
-			}
-
-			val := reflect.ValueOf(newOptions)
-			typ := val.Type()
-			for i := 0; i < val.NumField(); i++ {
-				field := typ.Field(i)
-				value := val.Field(i)
-
-				// safety checks
-				if !value.IsValid() || !value.CanInterface() {
-					continue
-				}
-
-				// Convert any integer kind to int in a safe way
-				var castVal int
-				switch value.Kind() {
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-					castVal = int(value.Int())
-				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-					castVal = int(value.Uint())
-				default:
-					log.Printf("unsupported kind %s for field %s", value.Kind(), field.Name)
-					continue
-				}
-
-				// Extract the JSON tag key without ,omitempty
-				tagName := field.Tag.Get("json")
-				if idx := strings.Index(tagName, ","); idx != -1 {
-					tagName = tagName[:idx]
+			// pending change requests are applied in turn, each one over the former
+			for _, changeRequest := range pendingChangeRequests(changesData.Changes) {
+				newOptions := map[string]int{}
+				if err := json.Unmarshal([]byte(changeRequest.NewOptions), &newOptions); err != nil {
+					return nil, err
 				}
-
-				switch tagName {
-				case "vm_type":
-					vmType = strconv.Itoa(castVal + 1)
-				case "vm_mem":
-					vmRam = castVal
-				case "vm_core":
-					vmCores = castVal
-				case "vm_diskspace":
-					vmHdSize = castVal
+				for _, optionID := range slices.Sorted(maps.Keys(newOptions)) {
+					itemCount := newOptions[optionID]
+					switch optionID {
+					case "vm_type":
+						vmType = strconv.Itoa(itemCount + 1)
+					case "vm_mem":
+						vmRam = itemCount
+					case "vm_core":
+						vmCores = itemCount
+					case "vm_diskspace":
+						vmHdSize = itemCount
+					}
 				}
+				pendingChangeAt = changeRequest.ScheduledDate
 			}
 		}
 
 		operatingSystem := ""
 		if orderData.Order.ProvisioningOptions.Provisioning.Os != "" {
 			// obtain operating systems
-			operatingSystems, err := c.GetOperatingSystems()
+			operatingSystems, err := c.GetOperatingSystems(ctx)
 			if err != nil {
 				return nil, err
 			}
@@ -249,13 +225,13 @@ func (c *Client) GetVm(orderID string) (*Vm, error) {
 					break
 				}
 			}
-			log.Printf("Obtained operating system tag '%s' from ID <%s>", operatingSystem, orderData.Order.ProvisioningOptions.Provisioning.Os)
+			tflog.Debug(ctx, "Obtained operating system tag", map[string]any{"os_tag": operatingSystem, "os_id": orderData.Order.ProvisioningOptions.Provisioning.Os})
 		}
 
 		locationCode := ""
 		if orderData.Order.ProvisioningOptions.Provisioning.Location != "" {
 			// obtain locations
-			locations, err := c.GetLocations()
+			locations, err := c.GetLocations(ctx)
 			if err != nil {
 				return nil, err
 			}
@@ -265,13 +241,13 @@ func (c *Client) GetVm(orderID string) (*Vm, error) {
 					break
 				}
 			}
-			log.Printf("Obtained location code '%s' from ID <%s>", locationCode, orderData.Order.ProvisioningOptions.Provisioning.Location)
+			tflog.Debug(ctx, "Obtained location code", map[string]any{"location_code": locationCode, "location_id": orderData.Order.ProvisioningOptions.Provisioning.Location})
 		}
 
 		var vpcNumbers []int32
 		// obtain all VPC members and see if our order is in there
 		// @todo support for multiple VPCs
-		vpcMembers, err := c.GetVpcMembers()
+		vpcMembers, err := c.GetVpcMembers(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -280,7 +256,7 @@ func (c *Client) GetVm(orderID string) (*Vm, error) {
 				vpcNumbers = append(vpcNumbers, vpcMember.Vxlan)
 			}
 		}
-		log.Printf("Obtained VPC numbers '%v' for order ID %v", vpcNumbers, orderData.Order.ID)
+		tflog.Debug(ctx, "Obtained VPC numbers", map[string]any{"vpc_numbers": vpcNumbers, "order_id": orderData.Order.ID})
 
 		// populate the VM with obtained data values
 		vm := Vm{
@@ -301,12 +277,18 @@ func (c *Client) GetVm(orderID string) (*Vm, error) {
 			Gateway:     orderData.Order.ProvisioningOptions.Provisioning.Gateway,
 			DnsServer:   orderData.Order.ProvisioningOptions.Provisioning.DnsServer,
 			Vpc:         vpcNumbers,
+			Comments:    orderData.Order.ProvisioningOptions.Comments,
+			Description: orderData.Order.CustomDescription,
+			Reference:   orderData.Order.Reference,
+
+			PendingChangeAt: pendingChangeAt,
+			EndDate:         orderData.Order.EndDate,
 		}
 		err = json.Unmarshal(bodyOrder, &vm)
 		if err != nil {
 			return nil, err
 		}
-		log.Printf("VM: %+v\n", vm)
+		tflog.Debug(ctx, "Obtained VM", map[string]any{"order_id": vm.OrderID, "vm_uuid": vm.ID, "product": vm.VmProductID})
 
 		return &vm, nil
 	} else {
@@ -315,12 +297,12 @@ func (c *Client) GetVm(orderID string) (*Vm, error) {
 	}
 }
 
-func getOperatingSystemID(c *Client, osTag string) (string, error) {
-	log.Printf("Looking up operating system ID for tag '%s'", osTag)
+func getOperatingSystemID(ctx context.Context, c *Client, osTag string) (string, error) {
+	tflog.Debug(ctx, "Looking up operating system ID", map[string]any{"os_tag": osTag})
 	operatingSystemID := ""
 	if osTag != "" {
 		// obtain operating systems
-		operatingSystems, err := c.GetOperatingSystems()
+		operatingSystems, err := c.GetOperatingSystems(ctx)
 		if err != nil {
 			return "", err
 		}
@@ -330,17 +312,17 @@ func getOperatingSystemID(c *Client, osTag string) (string, error) {
 				break
 			}
 		}
-		log.Printf("Obtained operating system ID <%s> for tag '%s'", operatingSystemID, osTag)
+		tflog.Debug(ctx, "Obtained operating system ID", map[string]any{"os_id": operatingSystemID, "os_tag": osTag})
 	}
 
 	return operatingSystemID, nil
 }
 
-func getLocationID(c *Client, locationCode string) (string, error) {
-	log.Printf("Looking up location ID for code '%s'", locationCode)
+func getLocationID(ctx context.Context, c *Client, locationCode string) (string, error) {
+	tflog.Debug(ctx, "Looking up location ID", map[string]any{"location_code": locationCode})
 	locationID := ""
 	if locationCode != "" {
-		locations, err := c.GetLocations()
+		locations, err := c.GetLocations(ctx)
 		if err != nil {
 			return "", err
 		}
@@ -350,17 +332,17 @@ func getLocationID(c *Client, locationCode string) (string, error) {
 				break
 			}
 		}
-		log.Printf("Obtained location ID <%s> for code '%s'", locationID, locationCode)
+		tflog.Debug(ctx, "Obtained location ID", map[string]any{"location_id": locationID, "location_code": locationCode})
 	}
 
 	return locationID, nil
 }
 
-func getVxlanID(c *Client, vpcNumber int32) (string, error) {
-	log.Printf("Looking up VxLAN ID for number '%d'", vpcNumber)
+func getVxlanID(ctx context.Context, c *Client, vpcNumber int32) (string, error) {
+	tflog.Debug(ctx, "Looking up VxLAN ID", map[string]any{"vpc_number": vpcNumber})
 	vxlanID := ""
 	if vpcNumber > 0 {
-		vxlans, err := c.GetVpcs()
+		vxlans, err := c.GetVpcs(ctx)
 		if err != nil {
 			return "", err
 		}
@@ -370,12 +352,48 @@ func getVxlanID(c *Client, vpcNumber int32) (string, error) {
 				break
 			}
 		}
-		log.Printf("Obtained VxLAN ID <%s> for number '%d'", vxlanID, vpcNumber)
+		tflog.Debug(ctx, "Obtained VxLAN ID", map[string]any{"vxlan_id": vxlanID, "vpc_number": vpcNumber})
 	}
 
 	return vxlanID, nil
 }
 
+// leaveVpcs removes the order from all VPCs it is a member of
+func leaveVpcs(ctx context.Context, c *Client, orderID int) error {
+	vpcMembers, err := c.GetVpcMembers(ctx)
+	if err != nil {
+		return err
+	}
+	vpcs, err := c.GetVpcs(ctx)
+	if err != nil {
+		return err
+	}
+	vxlanIDs := make(map[int32]string, len(vpcs))
+	for _, vpc := range vpcs {
+		vxlanIDs[vpc.Number] = vpc.ID
+	}
+
+	for _, vpcMember := range vpcMembers {
+		if vpcMember.OrderID != orderID {
+			continue
+		}
+		rb, err := json.Marshal(map[string]int{"orderid": orderID})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/backend/com.newvm.network/v1/vxlan/%s/members", c.HostURL, vxlanIDs[vpcMember.Vxlan]), strings.NewReader(string(rb)))
+		if err != nil {
+			return err
+		}
+		if _, err := c.doRequest(req); err != nil {
+			return err
+		}
+		tflog.Debug(ctx, "Removed VM from VPC", map[string]any{"order_id": orderID, "vpc_number": vpcMember.Vxlan})
+	}
+
+	return nil
+}
+
 func splitVmProductID(vmProductID string) (string, int, error) {
 	productCode := vmProductID[0:4] // 'VM-A' part
 	typePart := vmProductID[4:]     // 'x' part
@@ -388,8 +406,9 @@ func splitVmProductID(vmProductID string) (string, int, error) {
 	return productCode, vmType, nil
 }
 
-// CreateVm - Create new vm order
-func (c *Client) CreateVm(vm Vm) (*Vm, error) {
+// CreateVm - Create new vm order, or adopt the order placed earlier with the same reference whose response was lost.
+// An order that may have been placed, but cannot be looked up, is reported as an *OrderNotConfirmedError.
+func (c *Client) CreateVm(ctx context.Context, vm Vm) (*Vm, error) {
 	// Order @NewVM Order structure
 	type NewVmOrderOption struct {
 		VmCore      int `json:"vm_core,omitempty"`
@@ -413,31 +432,48 @@ func (c *Client) CreateVm(vm Vm) (*Vm, error) {
 	type NewVmOrder struct {
 		Amount            NewVmOrderOption  `json:"amount,omitempty"`
 		CustomDescription string            `json:"custom_description,omitempty"`
+		Comments          string            `json:"comments,omitempty"`
 		Parent            string            `json:"parentid,omitempty"`
 		Provisioning      NewVmProvisioning `json:"provisioning,omitempty"`
 		AutoProvision     bool              `json:"autoProvision,omitempty"`
 		FinishOrderGroup  bool              `json:"finishOrderGroup,omitempty"`
 		PromoCodes        []string          `json:"promoCodes,omitempty"`
+		Reference         string            `json:"reference,omitempty"`
 	}
 	// split vm product ID to get product code and type
 	productCode, vmType, err := splitVmProductID(vm.VmProductID)
 	if err != nil {
 		panic(err) // ... handle error
 	}
+	// adopt the order of an earlier attempt whose response was lost, instead of ordering again
+	if vm.Reference != "" {
+		existing, err := c.GetOrderByReference(ctx, vm.Reference)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			tflog.Info(ctx, "Adopting existing order with the same reference", map[string]any{"order_id": existing.ID, "reference": vm.Reference})
+			vm.OrderID = existing.ID
+			return &vm, nil
+		}
+	}
 	// get operating system ID
-	osID, err := getOperatingSystemID(c, vm.Os)
+	osID, err := getOperatingSystemID(ctx, c, vm.Os)
 	if err != nil {
 		return nil, err
 	}
 	// get location ID
-	locationID, err := getLocationID(c, vm.Location)
+	locationID, err := getLocationID(ctx, c, vm.Location)
 	if err != nil {
 		return nil, err
 	}
-	// get VxLAN ID
-	vxlanID, err := getVxlanID(c, vm.Vpc[0])
-	if err != nil {
-		return nil, err
+	// get VxLAN ID, the order is placed in the first VPC only
+	vxlanID := ""
+	if len(vm.Vpc) > 0 {
+		vxlanID, err = getVxlanID(ctx, c, vm.Vpc[0])
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	provisioning := NewVmProvisioning{
@@ -472,11 +508,14 @@ func (c *Client) CreateVm(vm Vm) (*Vm, error) {
 			VmMem:       int(vm.Ram),
 			VmType:      vmType,
 		},
-		CustomDescription: "",
+		CustomDescription: vm.Description,
+		Comments:          vm.Comments,
 		// parent: "",
 		Provisioning:     provisioning,
 		AutoProvision:    true,
 		FinishOrderGroup: true,
+		PromoCodes:       vm.PromoCodes,
+		Reference:        vm.Reference,
 	}
 
 	rb, err := json.Marshal(newVmOrder)
@@ -484,12 +523,22 @@ func (c *Client) CreateVm(vm Vm) (*Vm, error) {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/account/v1/customer/self/order/%s", c.HostURL, productCode), strings.NewReader(string(rb)))
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/account/v1/customer/self/order/%s", c.HostURL, productCode), strings.NewReader(string(rb)))
 	if err != nil {
 		return nil, err
 	}
 
 	body, err := c.doRequest(req)
+	if err != nil && vm.Reference != "" {
+		// the order may have been placed even though its response was lost
+		placed, confirmErr := c.confirmOrder(ctx, vm.Reference, err)
+		if confirmErr != nil {
+			return nil, confirmErr
+		}
+		tflog.Info(ctx, "Adopting order placed by the failed request", map[string]any{"order_id": placed.ID, "reference": vm.Reference})
+		vm.OrderID = placed.ID
+		return &vm, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -508,7 +557,7 @@ func (c *Client) CreateVm(vm Vm) (*Vm, error) {
 }
 
 // UpdateVm - Updates an order
-func (c *Client) UpdateVm(orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
+func (c *Client) UpdateVm(ctx context.Context, orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
 	// Order @NewVM Change request structure
 	type NewVmChangeOption struct {
 		VmCore      int `json:"vm_core"`
@@ -518,7 +567,8 @@ func (c *Client) UpdateVm(orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
 	}
 	// @todo support custom.hardDiskSizes
 	type NewVmChangeRequest struct {
-		Options NewVmChangeOption `json:"options"`
+		Options       NewVmChangeOption `json:"options"`
+		ScheduledDate string            `json:"scheduled_date,omitempty"`
 	}
 
 	// helper to compare attr.Value
@@ -568,12 +618,16 @@ func (c *Client) UpdateVm(orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
 				VmType:      vmTypeNew,
 			},
 		}
+		newVmChange.ScheduledDate, err = scheduledDate(vmNew.ApplyChangesAt)
+		if err != nil {
+			return nil, err
+		}
 		rb, err := json.Marshal(newVmChange)
 		if err != nil {
 			return nil, err
 		}
 		// change request
-		reqChange, err := http.NewRequest("PUT", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, orderID), strings.NewReader(string(rb)))
+		reqChange, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, orderID), strings.NewReader(string(rb)))
 		if err != nil {
 			return nil, err
 		}
@@ -587,6 +641,18 @@ func (c *Client) UpdateVm(orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
 		if err != nil {
 			return nil, err
 		}
+
+		var changeResult changeRequestResult
+		err = json.Unmarshal(resChange, &changeResult)
+		if err != nil {
+			return nil, err
+		}
+		// scheduled changes are applied later, in the maintenance window
+		if newVmChange.ScheduledDate == "" {
+			if err := c.waitForChangeRequest(ctx, orderID, changeResult.ChangeRequestID); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// check if VPCs have changed
@@ -602,7 +668,7 @@ func (c *Client) UpdateVm(orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
 		}
 
 		// obtain all VPCs and index them by ID
-		vpcList, errVpcList := c.GetVpcs()
+		vpcList, errVpcList := c.GetVpcs(ctx)
 		if errVpcList != nil {
 			tmpVm := Vm{}
 			return &tmpVm, errVpcList
@@ -635,7 +701,7 @@ func (c *Client) UpdateVm(orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
 				// add new VPC member
 				oid, err := strconv.ParseInt(orderID, 10, 32)
 				if err != nil {
-					fmt.Println("Conversion error:", err)
+					tflog.Error(ctx, "Conversion error", map[string]any{"error": err.Error()})
 					return nil, err
 				}
 				vpcMemberOrder := VpcMemberRequest{
@@ -645,7 +711,7 @@ func (c *Client) UpdateVm(orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
 				if err != nil {
 					return nil, err
 				}
-				reqVpcMember, err := http.NewRequest("POST", fmt.Sprintf("%s/backend/com.newvm.network/v1/vxlan/%s/members", c.HostURL, vpcsByNumber[v].ID), strings.NewReader(string(rb)))
+				reqVpcMember, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/backend/com.newvm.network/v1/vxlan/%s/members", c.HostURL, vpcsByNumber[v].ID), strings.NewReader(string(rb)))
 				if err != nil {
 					return nil, err
 				}
@@ -668,7 +734,7 @@ func (c *Client) UpdateVm(orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
 				// remove VPC member
 				oid, err := strconv.ParseInt(orderID, 10, 32)
 				if err != nil {
-					fmt.Println("Conversion error:", err)
+					tflog.Error(ctx, "Conversion error", map[string]any{"error": err.Error()})
 					return nil, err
 				}
 				vpcMemberOrder := VpcMemberRequest{
@@ -678,7 +744,7 @@ func (c *Client) UpdateVm(orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
 				if err != nil {
 					return nil, err
 				}
-				reqVpcMember, err := http.NewRequest("DELETE", fmt.Sprintf("%s/backend/com.newvm.network/v1/vxlan/%s/members", c.HostURL, vpcsByNumber[v].ID), strings.NewReader(string(rb)))
+				reqVpcMember, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/backend/com.newvm.network/v1/vxlan/%s/members", c.HostURL, vpcsByNumber[v].ID), strings.NewReader(string(rb)))
 				if err != nil {
 					return nil, err
 				}
@@ -703,95 +769,94 @@ func (c *Client) UpdateVm(orderID string, vmOld *Vm, vmNew Vm) (*Vm, error) {
 	return &vmOrder, nil
 }
 
-// DeleteVm - Deletes a VM
-func (c *Client) DeleteVm(orderID string) error {
+// DeleteVm - Stops a VM and ends its order as the policy says, returns the end date of the order (empty for stop_only).
+// Running child orders, such as control panels, are ended on the same date with endChildOrders, otherwise the VM
+// is left as is and a *ChildOrdersError is returned. An order that no longer exists is reported as an error for which
+// IsNotFound is true.
+func (c *Client) DeleteVm(ctx context.Context, orderID string, policy DeletionPolicy, endChildOrders bool) (string, error) {
 	// obtain VM uuid
-	reqOrder, err := http.NewRequest("GET", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, orderID), nil)
+	reqOrder, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, orderID), nil)
 	if err != nil {
-		return err
+		return "", err
 	}
 	bodyOrder, err := c.doRequest(reqOrder)
 	if err != nil {
-		return err
+		return "", err
 	}
 	var orderData NewVmOrderWrapper
 	err = json.Unmarshal(bodyOrder, &orderData)
 	if err != nil {
-		return err
+		return "", err
+	}
+	tflog.Debug(ctx, "Obtained VM uuid", map[string]any{"vm_uuid": orderData.Order.ProvisioningData.VmUuid})
+	tflog.Debug(ctx, "Obtained billed until", map[string]any{"billed_until": orderData.Order.BilledUntil})
+
+	// check the child orders before touching the VM, a stopped VM keeps them valid
+	var childOrders []NewVmOrder
+	if policy != DeletionPolicyStopOnly {
+		childOrders, err = c.runningChildOrders(ctx, orderData.Order.ID)
+		if err != nil {
+			return "", err
+		}
+		if len(childOrders) > 0 && !endChildOrders {
+			return "", &ChildOrdersError{OrderID: orderData.Order.ID, ChildOrders: childOrders}
+		}
 	}
-	log.Printf("Obtained VM uuid: %s", orderData.Order.ProvisioningData.VmUuid)
-	log.Printf("Obtained Billed until: %s", orderData.Order.BilledUntil)
 
 	if orderData.Order.ProvisioningData.VmUuid != "" {
 		// get current state of VM
-		reqState, err := http.NewRequest("GET", fmt.Sprintf("%s/backend/com.newvm.network/v1/vm/%s", c.HostURL, orderData.Order.ProvisioningData.VmUuid), nil)
+		reqState, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/backend/com.newvm.network/v1/vm/%s", c.HostURL, orderData.Order.ProvisioningData.VmUuid), nil)
 		if err != nil {
-			return err
+			return "", err
 		}
 		bodyState, err := c.doRequest(reqState)
 		if err != nil {
-			return err
+			return "", err
 		}
 		var stateData NewVmVmWrapper
 		err = json.Unmarshal(bodyState, &stateData)
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		if stateData.Vm.Status == "STOPPED" {
-			log.Printf("VM %s state is already 'STOPPED'", orderID)
+			tflog.Debug(ctx, "VM state is already STOPPED", map[string]any{"order_id": orderID})
 		} else {
 			// turn off VM if not off already
-			reqTurnOff, err := http.NewRequest("PATCH", fmt.Sprintf("%s/backend/com.newvm.network/v1/vm2/%s/changeState/off", c.HostURL, orderData.Order.ProvisioningData.VmUuid), nil)
+			reqTurnOff, err := http.NewRequestWithContext(ctx, "PATCH", fmt.Sprintf("%s/backend/com.newvm.network/v1/vm2/%s/changeState/off", c.HostURL, orderData.Order.ProvisioningData.VmUuid), nil)
 			if err != nil {
-				return err
+				return "", err
 			}
 			_, err = c.doRequest(reqTurnOff)
 			if err != nil {
-				return err
+				return "", err
 			}
-			log.Printf("Turned off VM %s", orderID)
+			tflog.Debug(ctx, "Turned off VM", map[string]any{"order_id": orderID})
 		}
 	}
 
-	// set end date for order
-	type NewVmOrderEnd struct {
-		EndDate          string `json:"end_date"`
-		IncludeSubOrders bool   `json:"includeSubOrders,omitempty"`
+	// detach the VM from its VPCs, so they can be deleted after the VM
+	if err := leaveVpcs(ctx, c, orderData.Order.ID); err != nil {
+		return "", err
 	}
-	endDate, err := time.Parse("2006-01-02T15:04:05.000Z07:00", orderData.Order.BilledUntil) // this is the format for RFC3339 including milliseconds
-	if err != nil {
-		panic(err)
-	}
-	timezone, err := time.LoadLocation("Europe/Amsterdam")
-	if err != nil {
-		panic(err)
-	}
-	newVmOrderEnd := NewVmOrderEnd{
-		EndDate:          endDate.In(timezone).Format("2006-01-02"), // this is the format for YYYY-MM-DD
-		IncludeSubOrders: true,
-	}
-	reqBodyOrderEnd, err := json.Marshal(newVmOrderEnd)
+
+	// set end date for order
+	endDate, err := c.orderEndDate(orderData.Order.BilledUntil, policy)
 	if err != nil {
-		return err
+		return "", err
 	}
-	reqOrderEnd, err := http.NewRequest("PUT", fmt.Sprintf("%s/account/v1/order/%s/enddate", c.HostURL, orderID), strings.NewReader(string(reqBodyOrderEnd)))
-	if err != nil {
-		return err
+	if endDate == "" {
+		tflog.Debug(ctx, "Stopped VM without ending its order", map[string]any{"order_id": orderID})
+		return "", nil
 	}
-	resBodyOrderEnd, err := c.doRequest(reqOrderEnd)
-	if err != nil {
-		return err
+	for _, childOrder := range childOrders {
+		if err := c.setOrderEndDate(ctx, strconv.Itoa(childOrder.ID), endDate); err != nil {
+			return "", err
+		}
 	}
-
-	if strings.ReplaceAll(string(resBodyOrderEnd), " ", "") != "{\"success\":true}" {
-		return errors.New(string(resBodyOrderEnd))
+	if err := c.setOrderEndDate(ctx, orderID, endDate); err != nil {
+		return "", err
 	}
-	log.Printf("Set end date for order %s", orderID)
 
-	// @todo also delete sub orders
-	// @todo also delete sub orders
-	// @todo also delete sub orders
-
-	return nil
+	return endDate, nil
 }
@@ -0,0 +1,90 @@
+package newvm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestGetVmProducts(t *testing.T) {
+	client := newReplayClient(t, "vm_products")
+
+	vmProducts, err := client.GetVmProducts(context.Background())
+	if err != nil {
+		t.Fatalf("GetVmProducts: %v", err)
+	}
+
+	expected := []VmProduct{
+		{ID: "VM-A1", ProductID: "VM-A", Ram: 1, Cores: 1, HdSize: 25, Price: 4.5},
+		// the vm_mem property of option index 1 must not override the memory of VM-A2
+		{ID: "VM-A2", ProductID: "VM-A", Ram: 2, Cores: 2, HdSize: 50, Price: 8.5},
+		{ID: "VM-A3", ProductID: "VM-A", Ram: 8, Cores: 4, HdSize: 100, Price: 17},
+		// properties are matched by ID and option index, not by their order
+		{ID: "VM-B1", ProductID: "VM-B", Ram: 16, Cores: 4, HdSize: 200, Price: 9},
+		{ID: "VM-B2", ProductID: "VM-B", Ram: 32, Cores: 8, HdSize: 400, Price: 39},
+	}
+	if !reflect.DeepEqual(vmProducts, expected) {
+		t.Fatalf("unexpected VM products:\n got: %+v\nwant: %+v", vmProducts, expected)
+	}
+}
+
+func TestGetVmProductsWithoutVmB(t *testing.T) {
+	client := newReplayClient(t, "vm_products_partial")
+
+	vmProducts, err := client.GetVmProducts(context.Background())
+	if err != nil {
+		t.Fatalf("GetVmProducts: %v", err)
+	}
+
+	ids := []string{}
+	for _, vmProduct := range vmProducts {
+		ids = append(ids, vmProduct.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"VM-A1", "VM-A2", "VM-A3"}) {
+		t.Fatalf("expected only the VM-A products, got %v", ids)
+	}
+}
+
+func TestGetVmProductsInvalidProperty(t *testing.T) {
+	client := newReplayClient(t, "vm_products_invalid")
+
+	if _, err := client.GetVmProducts(context.Background()); err == nil {
+		t.Fatal("expected an error for a fractional memory size")
+	}
+}
+
+func TestGetVmWithChangeRequest(t *testing.T) {
+	client := newReplayClient(t, "vm_with_change_request")
+
+	vm, err := client.GetVm(context.Background(), "4711")
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+
+	expected := &Vm{
+		ID:          "5f0c6d3e-8a51-4c1e-9d0b-2f4f7d0e6a11",
+		OrderID:     4711,
+		VmProductID: "VM-A2", // vm_type 1 from the pending change request
+		Os:          "debian-12",
+		Hostname:    "web1.example.com",
+		Location:    "AMS1",
+		Ram:         4,
+		Cores:       2,
+		HdSize:      10,
+		SshKey:      "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExampleKey user@example.com",
+		Vpc:         []int32{1201, 1305},
+		IpAddress:   "203.0.113.17",
+	}
+	if !reflect.DeepEqual(vm, expected) {
+		t.Fatalf("unexpected VM:\n got: %+v\nwant: %+v", vm, expected)
+	}
+}
+
+func TestGetVmWithInvalidChangeRequest(t *testing.T) {
+	client := newReplayClient(t, "vm_with_invalid_change_request")
+
+	// a malformed pending change request fails the read instead of the provider
+	if _, err := client.GetVm(context.Background(), "4711"); err == nil {
+		t.Fatal("expected an error for the malformed change request")
+	}
+}
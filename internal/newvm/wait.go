@@ -0,0 +1,250 @@
+package newvm
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// DefaultPollInterval - Wait between two checks of an order that is being provisioned or changed
+const DefaultPollInterval = 10 * time.Second
+
+// VmStatusRunning - Status of a VM that finished provisioning and is powered on
+const VmStatusRunning = "RUNNING"
+
+// vmFailedStatuses are the statuses of a VM that will never run without intervention
+var vmFailedStatuses = []string{"ERROR", "FAILED"}
+
+// WithPollInterval - Sets the wait between two checks while waiting for provisioning and changes
+func WithPollInterval(interval time.Duration) ClientOption {
+	return func(c *Client) {
+		c.pollInterval = interval
+	}
+}
+
+// poll calls check until it reports done, waiting the poll interval between
+// calls. It gives up when check fails or ctx is done; describe is asked for
+// the last known state to explain a timeout.
+func (c *Client) poll(ctx context.Context, check func(ctx context.Context) (bool, error), describe func() string) error {
+	for {
+		done, err := check(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return err
+		}
+		if done {
+			return nil
+		}
+		if sleepContext(ctx, c.pollInterval) != nil {
+			break
+		}
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out, %s", describe())
+	}
+	return ctx.Err()
+}
+
+// WaitForVm - Waits until the VM of an order is provisioned and running, and returns it
+func (c *Client) WaitForVm(ctx context.Context, orderID string) (*Vm, error) {
+	vmOrderID := 0
+	vmUuid := ""
+	vmStatus := ""
+
+	err := c.poll(ctx, func(ctx context.Context) (bool, error) {
+		// the VM uuid is only known once the order is provisioned
+		if vmUuid == "" {
+			reqOrder, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/order/%s", c.HostURL, orderID), nil)
+			if err != nil {
+				return false, err
+			}
+			bodyOrder, err := c.doRequest(reqOrder)
+			if err != nil {
+				return false, err
+			}
+			var orderData NewVmOrderWrapper
+			if err := json.Unmarshal(bodyOrder, &orderData); err != nil {
+				return false, err
+			}
+			if orderData.Order.ProvisioningError != "" {
+				return false, &ProvisioningError{OrderID: orderData.Order.ID, Message: orderData.Order.ProvisioningError}
+			}
+			vmOrderID = orderData.Order.ID
+			vmUuid = orderData.Order.ProvisioningData.VmUuid
+			if vmUuid == "" {
+				tflog.Debug(ctx, "Waiting for VM order to be provisioned", map[string]any{"order_id": orderID})
+				return false, nil
+			}
+		}
+
+		reqState, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/backend/com.newvm.network/v1/vm/%s", c.HostURL, vmUuid), nil)
+		if err != nil {
+			return false, err
+		}
+		bodyState, err := c.doRequest(reqState)
+		if err != nil {
+			return false, err
+		}
+		var stateData NewVmVmWrapper
+		if err := json.Unmarshal(bodyState, &stateData); err != nil {
+			return false, err
+		}
+		vmStatus = stateData.Vm.Status
+		tflog.Debug(ctx, "Obtained VM status", map[string]any{"order_id": orderID, "vm_uuid": vmUuid, "status": vmStatus})
+		if slices.Contains(vmFailedStatuses, vmStatus) {
+			return false, &ProvisioningError{OrderID: vmOrderID, VmUuid: vmUuid, Status: vmStatus}
+		}
+
+		return vmStatus == VmStatusRunning, nil
+	}, func() string {
+		if vmUuid == "" {
+			return fmt.Sprintf("order %s has no VM yet", orderID)
+		}
+		return fmt.Sprintf("VM %s of order %s is %q instead of %q", vmUuid, orderID, vmStatus, VmStatusRunning)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("waiting for VM order %s to be provisioned: %w", orderID, err)
+	}
+
+	return c.GetVm(ctx, orderID)
+}
+
+// ProvisioningError - VM order that NewVM failed to provision
+type ProvisioningError struct {
+	OrderID int
+	VmUuid  string // empty when provisioning failed before the VM was created
+	Status  string // status the VM ended up in
+	Message string // provisioning error reported by the API
+}
+
+func (e *ProvisioningError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("provisioning order %d failed: %s", e.OrderID, e.Message)
+	}
+	return fmt.Sprintf("provisioning order %d failed, VM %s is %q", e.OrderID, e.VmUuid, e.Status)
+}
+
+// ChangeRequestError - Change request that NewVM failed to apply
+type ChangeRequestError struct {
+	OrderID         int
+	ChangeRequestID int
+	Message         string // provisioning error reported by the API
+	Internal        bool   // the failure is on the NewVM side, not caused by the requested change
+}
+
+func (e *ChangeRequestError) Error() string {
+	if e.Internal {
+		return fmt.Sprintf("change request %d of order %d failed with an internal NewVM error: %s", e.ChangeRequestID, e.OrderID, e.Message)
+	}
+	return fmt.Sprintf("change request %d of order %d failed: %s", e.ChangeRequestID, e.OrderID, e.Message)
+}
+
+// scheduledDate returns the scheduled_date of a change request that is to
+// be applied at applyAt, an RFC 3339 timestamp. An empty applyAt applies the
+// change right away, for which it returns "". A time that has passed is an
+// error, applying the change right away would defeat the schedule.
+func scheduledDate(applyAt string) (string, error) {
+	if applyAt == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, applyAt)
+	if err != nil {
+		return "", fmt.Errorf("invalid time to apply changes at: %w", err)
+	}
+	if !t.After(time.Now()) {
+		return "", fmt.Errorf("time to apply changes at %s has passed, set a future time or remove it to apply changes right away", applyAt)
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// pendingChangeRequests returns the change requests that are still to be
+// applied, in the order they are applied in: the ones to apply right away
+// first, then the scheduled ones by date, each by ID within. Failed change
+// requests will not be applied.
+func pendingChangeRequests(changes []NewVmChangeRequest) []NewVmChangeRequest {
+	pending := slices.DeleteFunc(slices.Clone(changes), func(change NewVmChangeRequest) bool {
+		return change.ProvisioningError != ""
+	})
+	slices.SortStableFunc(pending, func(a, b NewVmChangeRequest) int {
+		return cmp.Or(strings.Compare(a.ScheduledDate, b.ScheduledDate), cmp.Compare(a.ID, b.ID))
+	})
+	return pending
+}
+
+// isScheduledLater reports whether a change request is scheduled to be
+// applied in the future, rather than right away.
+func isScheduledLater(change NewVmChangeRequest) bool {
+	if change.ScheduledDate == "" {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, change.ScheduledDate)
+	return err == nil && t.After(time.Now())
+}
+
+// changeRequestResult is the response to placing a change request.
+type changeRequestResult struct {
+	ChangeRequestID int `json:"changerequestid"`
+}
+
+// waitForChangeRequest waits until a change request of the order is applied,
+// which removes it from the outstanding change requests. A change request
+// ID of 0 waits for all outstanding change requests of the order, except the
+// ones scheduled for later.
+func (c *Client) waitForChangeRequest(ctx context.Context, orderID string, changeRequestID int) error {
+	pending := 0
+
+	err := c.poll(ctx, func(ctx context.Context) (bool, error) {
+		reqChanges, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/account/v1/order/changerequest?orderId=%s", c.HostURL, orderID), nil)
+		if err != nil {
+			return false, err
+		}
+		bodyChanges, err := c.doRequest(reqChanges)
+		if err != nil {
+			return false, err
+		}
+		changesData := NewVmChangeRequestsWrapper{}
+		if err := json.Unmarshal(bodyChanges, &changesData); err != nil {
+			return false, err
+		}
+
+		pending = 0
+		for _, change := range changesData.Changes {
+			if changeRequestID != 0 && change.ID != changeRequestID {
+				continue
+			}
+			if changeRequestID == 0 && isScheduledLater(change) {
+				continue
+			}
+			if change.ProvisioningError != "" {
+				return false, &ChangeRequestError{
+					OrderID:         change.OrderID,
+					ChangeRequestID: change.ID,
+					Message:         change.ProvisioningError,
+					Internal:        change.IsInternalError != 0,
+				}
+			}
+			pending++
+		}
+		tflog.Debug(ctx, "Obtained outstanding change requests", map[string]any{"order_id": orderID, "change_request_id": changeRequestID, "pending": pending})
+
+		return pending == 0, nil
+	}, func() string {
+		return fmt.Sprintf("%d change request(s) of order %s are still pending", pending, orderID)
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for the change of order %s to be applied: %w", orderID, err)
+	}
+
+	return nil
+}
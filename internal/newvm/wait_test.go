@@ -0,0 +1,280 @@
+package newvm_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+)
+
+func newFakeClient(t *testing.T, s *newvmtest.Server, opts ...newvm.ClientOption) *newvm.Client {
+	t.Helper()
+
+	opts = append([]newvm.ClientOption{newvm.WithPollInterval(time.Millisecond)}, opts...)
+	client, err := newvm.NewClient(context.Background(), &s.URL, &s.Username, &s.Password, nil, opts...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func createTestVm(t *testing.T, client *newvm.Client) string {
+	t.Helper()
+
+	created, err := client.CreateVm(context.Background(), newvm.Vm{
+		VmProductID: "VM-A2",
+		Os:          "debian-12",
+		Hostname:    "web1.example.com",
+		Ram:         2,
+		UseDhcp:     true,
+	})
+	if err != nil {
+		t.Fatalf("CreateVm: %v", err)
+	}
+	return strconv.Itoa(created.OrderID)
+}
+
+func TestWaitForVm(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	s.SlowProvisioning(3)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+
+	vm, err := client.WaitForVm(context.Background(), orderID)
+	if err != nil {
+		t.Fatalf("WaitForVm: %v", err)
+	}
+
+	order, _ := s.Order(vm.OrderID)
+	if vm.ID == "" || vm.ID != order.VmUUID || vm.IpAddress != order.VmIPAddress || order.VmStatus != newvm.VmStatusRunning {
+		t.Fatalf("expected the provisioned VM, got %+v for order %+v", vm, order)
+	}
+}
+
+func TestWaitForVmTimeout(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	s.SlowProvisioning(1_000_000)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.WaitForVm(ctx, orderID)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
+
+func TestWaitForVmReportsFailedProvisioning(t *testing.T) {
+	for name, fail := range map[string]func(s *newvmtest.Server){
+		"order error": func(s *newvmtest.Server) { s.FailProvisioning("no capacity left in location") },
+		"VM error":    func(s *newvmtest.Server) { s.FailVms("ERROR") },
+		"VM failed":   func(s *newvmtest.Server) { s.FailVms("FAILED") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newvmtest.NewServer(t)
+			fail(s)
+			client := newFakeClient(t, s)
+			orderID := createTestVm(t, client)
+
+			// a failure is reported right away, instead of waiting for the timeout
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err := client.WaitForVm(ctx, orderID)
+			var provisioningErr *newvm.ProvisioningError
+			if !errors.As(err, &provisioningErr) || strconv.Itoa(provisioningErr.OrderID) != orderID {
+				t.Fatalf("expected a provisioning error for order %s, got %v", orderID, err)
+			}
+		})
+	}
+}
+
+func TestUpdateVmWaitsForChangeRequest(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	s.SlowChanges(3)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+
+	vm, err := client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	resized := *vm
+	resized.Ram = 4
+	if _, err := client.UpdateVm(ctx, orderID, vm, resized); err != nil {
+		t.Fatalf("UpdateVm: %v", err)
+	}
+
+	if order, _ := s.Order(vm.OrderID); order.Options["vm_mem"] != 4 {
+		t.Fatalf("expected UpdateVm to return after the change was applied, got %v", order.Options)
+	}
+}
+
+func TestUpdateVmWaitsForChangeRequestWithoutID(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	s.OmitChangeRequestIDs(true)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+
+	vm, err := client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	scheduled := *vm
+	scheduled.Ram = 8
+	scheduled.ApplyChangesAt = time.Now().UTC().Add(time.Hour).Truncate(time.Second).Format(time.RFC3339)
+	if _, err := client.UpdateVm(ctx, orderID, vm, scheduled); err != nil {
+		t.Fatalf("UpdateVm: %v", err)
+	}
+
+	// a change without ID is waited for, but not the change scheduled for later
+	s.SlowChanges(3)
+	resized := *vm
+	resized.Ram = 4
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := client.UpdateVm(timeoutCtx, orderID, vm, resized); err != nil {
+		t.Fatalf("UpdateVm: %v", err)
+	}
+	if order, _ := s.Order(vm.OrderID); order.Options["vm_mem"] != 4 {
+		t.Fatalf("expected UpdateVm to return after the change was applied, got %v", order.Options)
+	}
+}
+
+func TestUpdateVmReportsFailedChangeRequest(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	s.FailChanges("insufficient capacity on host")
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+
+	vm, err := client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	resized := *vm
+	resized.Ram = 4
+	_, err = client.UpdateVm(ctx, orderID, vm, resized)
+
+	var changeErr *newvm.ChangeRequestError
+	if !errors.As(err, &changeErr) || changeErr.Message != "insufficient capacity on host" || changeErr.OrderID != vm.OrderID {
+		t.Fatalf("expected a change request error, got %v", err)
+	}
+
+	// the failed change is not shown as pending
+	vm, err = client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	if vm.VmProductID != "VM-A2" || vm.Ram != 2 {
+		t.Fatalf("expected the VM as before the failed change, got %+v", vm)
+	}
+}
+
+func TestUpdateVmSchedulesChange(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+	applyAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second).Format(time.RFC3339)
+
+	vm, err := client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	resized := *vm
+	resized.Ram = 4
+	resized.ApplyChangesAt = applyAt
+
+	// scheduled changes are not waited for
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := client.UpdateVm(timeoutCtx, orderID, vm, resized); err != nil {
+		t.Fatalf("UpdateVm: %v", err)
+	}
+	if order, _ := s.Order(vm.OrderID); order.Options["vm_mem"] != 2 {
+		t.Fatalf("expected the change to be scheduled, got %v", order.Options)
+	}
+
+	vm, err = client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	if vm.Ram != 4 || vm.PendingChangeAt != applyAt {
+		t.Fatalf("expected the scheduled change as pending, got ram %d pending at %q", vm.Ram, vm.PendingChangeAt)
+	}
+}
+
+func TestGetVmMergesScheduledChanges(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+
+	// changes scheduled one after the other, the last one not placed last
+	var applyAt string
+	for _, schedule := range []struct {
+		ram   int64
+		cores int
+		in    time.Duration
+	}{
+		{ram: 4, cores: 2, in: time.Hour},
+		{ram: 8, cores: 1, in: 3 * time.Hour},
+		{ram: 6, cores: 2, in: 2 * time.Hour},
+	} {
+		vm, err := client.GetVm(ctx, orderID)
+		if err != nil {
+			t.Fatalf("GetVm: %v", err)
+		}
+		resized := *vm
+		resized.Ram = schedule.ram
+		resized.Cores = schedule.cores
+		resized.ApplyChangesAt = time.Now().UTC().Add(schedule.in).Truncate(time.Second).Format(time.RFC3339)
+		if _, err := client.UpdateVm(ctx, orderID, vm, resized); err != nil {
+			t.Fatalf("UpdateVm: %v", err)
+		}
+		applyAt = max(applyAt, resized.ApplyChangesAt)
+	}
+
+	// the VM reads as it is once the last one is applied
+	vm, err := client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	if vm.Ram != 8 || vm.Cores != 1 || vm.PendingChangeAt != applyAt {
+		t.Fatalf("expected ram 8 and 1 core pending at %s, got ram %d and %d cores pending at %q", applyAt, vm.Ram, vm.Cores, vm.PendingChangeAt)
+	}
+}
+
+func TestUpdateVmRejectsPassedSchedule(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newFakeClient(t, s)
+	orderID := createTestVm(t, client)
+
+	vm, err := client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	resized := *vm
+	resized.Ram = 4
+	resized.ApplyChangesAt = time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+
+	// a stale time must not apply the change right away
+	if _, err := client.UpdateVm(ctx, orderID, vm, resized); err == nil || !strings.Contains(err.Error(), "has passed") {
+		t.Fatalf("UpdateVm: expected an error for a time that has passed, got %v", err)
+	}
+	for _, request := range s.Requests() {
+		if strings.HasPrefix(request, "PUT /account/v1/order/") {
+			t.Fatalf("expected no change request, got %s", request)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package newvmtest
+
+// Catalog responses served by the fake API. They follow the shape of the
+// real API, trimmed to the fields the provider reads.
+
+// products are served by GET /account/v1/product/{id}.
+var products = map[string]string{
+	"VM-A": `{
+		"id": "VM-A",
+		"description": "Virtual Machine A",
+		"base_price": 5,
+		"properties": [
+			{"id": "prop-mem", "key": "memory", "label": "Memory", "unit": "GB"},
+			{"id": "prop-cpu", "key": "cpu", "label": "vCPU", "unit": "cores"},
+			{"id": "prop-disk", "key": "diskspace", "label": "Disk space", "unit": "GB"}
+		],
+		"pricing": [
+			{"id": "vm_type", "type": "enum", "description": "VM type", "enum_options": [
+				{"enum_index": 0, "name": "VM-A1", "description": "A1", "price": 0},
+				{"enum_index": 1, "name": "VM-A2", "description": "A2", "price": 5},
+				{"enum_index": 2, "name": "VM-A3", "description": "A3", "price": 15}
+			]},
+			{"id": "vm_mem", "type": "quantity", "description": "Extra memory", "unit": "GB", "min": 0, "max": 64,
+				"pricing": [{"min": 0, "price": 0, "per": 1, "unit_price": 2.5}]},
+			{"id": "vm_core", "type": "quantity", "description": "Extra vCPU cores", "unit": "cores", "min": 0, "max": 16,
+				"pricing": [{"min": 0, "price": 0, "per": 1, "unit_price": 3}]},
+			{"id": "vm_diskspace", "type": "quantity", "description": "Extra disk space", "unit": "GB", "min": 0, "max": 2000,
+				"pricing": [{"min": 0, "price": 0, "per": 10, "unit_price": 1}]}
+		],
+		"product_option_properties": [
+			{"optionindex": 0, "property_id": "prop-mem", "product_option_id": "vm_type", "value": "1"},
+			{"optionindex": 0, "property_id": "prop-cpu", "product_option_id": "vm_type", "value": "1"},
+			{"optionindex": 0, "property_id": "prop-disk", "product_option_id": "vm_type", "value": "20"},
+			{"optionindex": 1, "property_id": "prop-mem", "product_option_id": "vm_type", "value": "2"},
+			{"optionindex": 1, "property_id": "prop-cpu", "product_option_id": "vm_type", "value": "2"},
+			{"optionindex": 1, "property_id": "prop-disk", "product_option_id": "vm_type", "value": "40"},
+			{"optionindex": 2, "property_id": "prop-mem", "product_option_id": "vm_type", "value": "4"},
+			{"optionindex": 2, "property_id": "prop-cpu", "product_option_id": "vm_type", "value": "4"},
+			{"optionindex": 2, "property_id": "prop-disk", "product_option_id": "vm_type", "value": "80"}
+		]
+	}`,
+	"VM-B": `{
+		"id": "VM-B",
+		"description": "Virtual Machine B",
+		"base_price": 10,
+		"properties": [
+			{"id": "prop-mem", "key": "memory", "label": "Memory", "unit": "GB"},
+			{"id": "prop-cpu", "key": "cpu", "label": "vCPU", "unit": "cores"},
+			{"id": "prop-disk", "key": "diskspace", "label": "Disk space", "unit": "GB"}
+		],
+		"pricing": [
+			{"id": "vm_type", "type": "enum", "description": "VM type", "enum_options": [
+				{"enum_index": 0, "name": "VM-B1", "description": "B1", "price": 0},
+				{"enum_index": 1, "name": "VM-B2", "description": "B2", "price": 20}
+			]}
+		],
+		"product_option_properties": [
+			{"optionindex": 0, "property_id": "prop-mem", "product_option_id": "vm_type", "value": "8"},
+			{"optionindex": 0, "property_id": "prop-cpu", "product_option_id": "vm_type", "value": "4"},
+			{"optionindex": 0, "property_id": "prop-disk", "product_option_id": "vm_type", "value": "100"},
+			{"optionindex": 1, "property_id": "prop-mem", "product_option_id": "vm_type", "value": "16"},
+			{"optionindex": 1, "property_id": "prop-cpu", "product_option_id": "vm_type", "value": "8"},
+			{"optionindex": 1, "property_id": "prop-disk", "product_option_id": "vm_type", "value": "200"}
+		]
+	}`,
+	"CP_DIRECTADMIN": `{
+		"id": "CP_DIRECTADMIN",
+		"description": "DirectAdmin",
+		"base_price": 0,
+		"default_price": 0,
+		"pricing": [
+			{"id": "da_license", "type": "enum", "description": "DirectAdmin license", "enum_options": [
+				{"enum_index": 0, "name": "personal", "description": "Personal", "price": 5},
+				{"enum_index": 1, "name": "lite", "description": "Lite", "price": 15},
+				{"enum_index": 2, "name": "standard", "description": "Standard", "price": 29}
+			]}
+		]
+	}`,
+	"CP_PLESK": `{
+		"id": "CP_PLESK",
+		"description": "Plesk",
+		"base_price": 0,
+		"default_price": 0,
+		"pricing": [
+			{"id": "plesk_12_license", "type": "enum", "description": "Plesk license", "enum_options": [
+				{"enum_index": 0, "name": "web_admin", "description": "Web Admin Edition", "price": 10},
+				{"enum_index": 1, "name": "web_pro", "description": "Web Pro Edition", "price": 18},
+				{"enum_index": 2, "name": "web_host", "description": "Web Host Edition", "price": 30}
+			]},
+			{"id": "plesk_extension_dnssec", "type": "flag", "description": "DNSSEC", "default_price": 1},
+			{"id": "plesk_extension_hosting_pack", "type": "flag", "description": "Hosting Pack", "default_price": 4},
+			{"id": "plesk_extension_powerpack", "type": "flag", "description": "Power Pack", "default_price": 6},
+			{"id": "plesk_extension_language_pack", "type": "flag", "description": "Language Pack", "default_price": 2}
+		]
+	}`,
+}
+
+// operatingSystems is served by GET /account/v1/provisioning/os.
+const operatingSystems = `{"result": [
+	{"id": "101", "idtag": "debian-12", "name": "Debian 12", "platform": "linux"},
+	{"id": "102", "idtag": "ubuntu-24.04", "name": "Ubuntu 24.04 LTS", "platform": "linux"},
+	{"id": "201", "idtag": "windows-2022", "name": "Windows Server 2022", "platform": "windows"}
+]}`
+
+// locations is served by GET /backend/com.newvm.network/v1/location.
+const locations = `{"locations": [
+	{"id": "1", "name": "Amsterdam", "extcode": "AMS1", "productIds": ["VM-A", "VM-B"], "provisionable": 1},
+	{"id": "2", "name": "Rotterdam", "extcode": "RTM1", "productIds": ["VM-A"], "provisionable": 1},
+	{"id": "3", "name": "Frankfurt", "extcode": "FRA1", "productIds": [], "provisionable": 0}
+]}`
+
+// optionTypes are the option types of the order options, options missing
+// here are quantities.
+var optionTypes = map[string]string{
+	"vm_type":                       "enum",
+	"da_license":                    "enum",
+	"plesk_12_license":              "enum",
+	"plesk_extension_dnssec":        "flag",
+	"plesk_extension_hosting_pack":  "flag",
+	"plesk_extension_powerpack":     "flag",
+	"plesk_extension_language_pack": "flag",
+}
+
+// optionDescriptions are the descriptions of the order options.
+var optionDescriptions = map[string]string{
+	"vm_type":                       "VM type",
+	"vm_mem":                        "Extra memory",
+	"vm_core":                       "Extra vCPU cores",
+	"vm_diskspace":                  "Extra disk space",
+	"da_license":                    "DirectAdmin license",
+	"plesk_12_license":              "Plesk license",
+	"plesk_extension_dnssec":        "DNSSEC",
+	"plesk_extension_hosting_pack":  "Hosting Pack",
+	"plesk_extension_powerpack":     "Power Pack",
+	"plesk_extension_language_pack": "Language Pack",
+}
@@ -0,0 +1,1019 @@
+// Package newvmtest provides an in-process fake of the NewVM API, so the
+// client and the provider can be exercised without api.newvm.com.
+package newvmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Default credentials accepted by the fake API.
+const (
+	DefaultUsername = "terraform@example.com"
+	DefaultPassword = "str0n9P4$$w0rD"
+)
+
+// billedUntilFormat is the timestamp format of billed_until in order responses.
+const billedUntilFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Server - Fake NewVM API with in-memory state
+type Server struct {
+	*httptest.Server
+
+	Username string
+	Password string
+
+	mu                sync.Mutex
+	holdChanges       bool
+	changePolls       int
+	changeError       string
+	omitChangeIDs     bool
+	provisioningPolls int
+	provisioningError string
+	failedVmStatus    string
+	lostOrders        int
+	failOrderLists    bool
+	lostOrderSent     bool
+	nextID            int
+	tokens            map[string]bool
+	unauthorized      map[string]bool
+	promoCodes        map[string]bool
+	orders            map[int]*Order
+	vpcs              map[string]*Vpc
+	members           []*VpcMember
+	changeRequests    []*ChangeRequest
+	requests          []string
+}
+
+// Order - Order as stored by the fake API
+type Order struct {
+	ID           int
+	ParentID     int
+	ProductID    string
+	Options      map[string]int // item count by option ID
+	Provisioning map[string]any // provisioning options as sent on creation
+	Description  string
+	Comments     string
+	PromoCodes   []string
+	Reference    string
+	BilledUntil  time.Time
+	EndDate      string // YYYY-MM-DD, empty while the order runs
+	VmUUID       string
+	VmIPAddress  string
+	VmStatus     string
+
+	ProvisioningError string // set when provisioning failed, the order never gets a VM
+
+	// reads left until the order reports its VM, and until the VM runs
+	hiddenPolls  int
+	pendingPolls int
+}
+
+// ChangeRequest - Change request as stored by the fake API
+type ChangeRequest struct {
+	ID                int
+	OrderID           int
+	Options           map[string]int
+	ScheduledDate     string
+	Applied           bool
+	ProvisioningError string // set when the change failed, it is never applied
+
+	pendingPolls int // change request list reads left until it is applied
+}
+
+// Vpc - VPC (VxLAN) as stored by the fake API
+type Vpc struct {
+	ID     string
+	Number int
+	Label  string
+}
+
+// VpcMember - VPC membership of an order as stored by the fake API
+type VpcMember struct {
+	ID         string
+	VpcID      string
+	OrderID    int
+	MacAddress string
+}
+
+// NewServer - Starts a fake API that is closed when the test finishes
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		Username:     DefaultUsername,
+		Password:     DefaultPassword,
+		nextID:       1000,
+		tokens:       map[string]bool{},
+		unauthorized: map[string]bool{},
+		promoCodes:   map[string]bool{},
+		orders:       map[int]*Order{},
+		vpcs:         map[string]*Vpc{},
+	}
+	s.Server = httptest.NewServer(s.handler())
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// ProviderConfig - Returns a provider block that points the newvm provider at the fake API,
+// with extra attribute lines such as `billing_timezone = "UTC"`
+func (s *Server) ProviderConfig(attributes ...string) string {
+	var extra strings.Builder
+	for _, attribute := range attributes {
+		extra.WriteString("  " + attribute + "\n")
+	}
+	return fmt.Sprintf(`
+provider "newvm" {
+  host          = %q
+  username      = %q
+  password      = %q
+  poll_interval = "10ms"
+%s}
+`, s.URL, s.Username, s.Password, extra.String())
+}
+
+// Order - Returns a copy of the order with the given ID
+func (s *Server) Order(id int) (Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[id]
+	if !ok {
+		return Order{}, false
+	}
+	copied := *order
+	copied.Options = maps.Clone(order.Options)
+	copied.Provisioning = maps.Clone(order.Provisioning)
+	copied.PromoCodes = slices.Clone(order.PromoCodes)
+	return copied, true
+}
+
+// Vpc - Returns a copy of the VPC with the given number
+func (s *Server) Vpc(number int) (Vpc, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, vpc := range s.vpcs {
+		if vpc.Number == number {
+			return *vpc, true
+		}
+	}
+	return Vpc{}, false
+}
+
+// VpcMembers - Returns the VPC numbers the order is a member of
+func (s *Server) VpcMembers(orderID int) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	numbers := []int{}
+	for _, member := range s.members {
+		if member.OrderID == orderID {
+			numbers = append(numbers, s.vpcs[member.VpcID].Number)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers
+}
+
+// HoldChanges - Keeps new change requests pending until ApplyChanges is
+// called, instead of applying them as soon as they are placed
+func (s *Server) HoldChanges(hold bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.holdChanges = hold
+}
+
+// ApplyChanges - Applies all pending change requests
+func (s *Server) ApplyChanges() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, change := range s.changeRequests {
+		s.applyChange(change)
+	}
+}
+
+// SlowChanges - Keeps new change requests pending until the change requests
+// of their order have been listed polls times, instead of applying them as
+// soon as they are placed
+func (s *Server) SlowChanges(polls int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.changePolls = polls
+}
+
+// FailChanges - Makes new change requests fail with the given provisioning
+// error, an empty message lets them succeed again
+func (s *Server) FailChanges(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.changeError = message
+}
+
+// OmitChangeRequestIDs - Answers new change requests without their ID, so
+// they can only be told apart from the other change requests of the order by
+// their scheduled date
+func (s *Server) OmitChangeRequestIDs(omit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.omitChangeIDs = omit
+}
+
+// SlowProvisioning - Makes new VMs report no uuid and IP address for the
+// first polls order reads, and then a PROVISIONING status for the first
+// polls VM state reads, instead of running right away
+func (s *Server) SlowProvisioning(polls int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.provisioningPolls = polls
+}
+
+// FailProvisioning - Makes new VM orders report the given provisioning error
+// and never get a VM, an empty message lets them be provisioned again
+func (s *Server) FailProvisioning(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.provisioningError = message
+}
+
+// FailVms - Makes new VMs end up in the given status instead of running, an
+// empty status lets them run again
+func (s *Server) FailVms(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failedVmStatus = status
+}
+
+// LoseOrderResponses - Places the next count orders, but answers them with a
+// 504 Gateway Timeout as if the response was lost on the way back
+func (s *Server) LoseOrderResponses(count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lostOrders = count
+}
+
+// FailOrderListsAfterLostOrders - Answers the order list with a 503 Service
+// Unavailable once an order response was lost, while fail is true, as if the
+// API went down along with it
+func (s *Server) FailOrderListsAfterLostOrders(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failOrderLists = fail
+}
+
+// AddPromoCodes - Makes the given promo codes valid for new orders, orders
+// with any other promo code are rejected
+func (s *Server) AddPromoCodes(codes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, code := range codes {
+		s.promoCodes[code] = true
+	}
+}
+
+// NewToken - Returns a new valid token, as an API token created in the NewVM portal
+func (s *Server) NewToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := fmt.Sprintf("token-%d", s.newID())
+	s.tokens[token] = true
+	return token
+}
+
+// ExpireTokens - Invalidates all session tokens, as if the sessions timed out
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.tokens)
+}
+
+// UnauthorizeRequests - Answers the given requests ("METHOD /path") with a
+// 401 Unauthorized whatever their token, as if the session lost access to
+// them
+func (s *Server) UnauthorizeRequests(requests ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, request := range requests {
+		s.unauthorized[request] = true
+	}
+}
+
+// Requests - Returns "METHOD /path" of every request received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.requests)
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	// authentication
+	mux.HandleFunc("POST /identity/v1", s.login)
+	mux.HandleFunc("DELETE /identity/v1", s.authenticated(s.logout))
+	mux.HandleFunc("GET /account/v1/token", s.authenticated(s.verifyToken))
+
+	// catalog, products are public
+	mux.HandleFunc("GET /account/v1/product/{id}", s.getProduct)
+	mux.HandleFunc("GET /account/v1/provisioning/os", s.authenticated(s.static(operatingSystems)))
+	mux.HandleFunc("GET /backend/com.newvm.network/v1/location", s.authenticated(s.static(locations)))
+
+	// orders
+	mux.HandleFunc("POST /account/v1/customer/self/order/{product}", s.authenticated(s.createOrder))
+	mux.HandleFunc("GET /account/v1/order", s.authenticated(s.getOrders))
+	mux.HandleFunc("GET /account/v1/order/changerequest", s.authenticated(s.getChangeRequests))
+	mux.HandleFunc("GET /account/v1/order/{id}", s.authenticated(s.getOrder))
+	mux.HandleFunc("PUT /account/v1/order/{id}", s.authenticated(s.changeOrder))
+	mux.HandleFunc("PUT /account/v1/order/{id}/enddate", s.authenticated(s.endOrder))
+
+	// VMs
+	mux.HandleFunc("GET /backend/com.newvm.network/v1/vm/{uuid}", s.authenticated(s.getVmState))
+	mux.HandleFunc("PATCH /backend/com.newvm.network/v1/vm2/{uuid}/changeState/{state}", s.authenticated(s.changeVmState))
+
+	// VPCs
+	mux.HandleFunc("GET /backend/com.newvm.network/v1/vxlan", s.authenticated(s.getVpcs))
+	mux.HandleFunc("POST /backend/com.newvm.network/v1/vxlan", s.authenticated(s.createVpc))
+	mux.HandleFunc("GET /backend/com.newvm.network/v1/vxlan/member", s.authenticated(s.getVpcMembers))
+	mux.HandleFunc("GET /backend/com.newvm.network/v1/vxlan/{id}", s.authenticated(s.getVpc))
+	mux.HandleFunc("PUT /backend/com.newvm.network/v1/vxlan/{id}", s.authenticated(s.updateVpc))
+	mux.HandleFunc("DELETE /backend/com.newvm.network/v1/vxlan/{id}", s.authenticated(s.deleteVpc))
+	mux.HandleFunc("POST /backend/com.newvm.network/v1/vxlan/{id}/members", s.authenticated(s.addVpcMember))
+	mux.HandleFunc("DELETE /backend/com.newvm.network/v1/vxlan/{id}/members", s.authenticated(s.removeVpcMember))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authenticated rejects requests without a valid session token. The
+// wrapped handler runs with the state lock held.
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if !s.tokens[r.Header.Get("X-Auth-Token")] || s.unauthorized[r.Method+" "+r.URL.Path] {
+			writeError(w, http.StatusUnauthorized, "invalid or expired token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) static(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	var credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if !readJSON(w, r, &credentials) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if credentials.Username != s.Username || credentials.Password != s.Password {
+		writeError(w, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+
+	token := fmt.Sprintf("token-%d", s.newID())
+	s.tokens[token] = true
+	writeJSON(w, map[string]any{"token": token})
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	delete(s.tokens, r.Header.Get("X-Auth-Token"))
+	writeSuccess(w)
+}
+
+func (s *Server) verifyToken(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{"valid": true})
+}
+
+func (s *Server) getProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := products[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+	s.static(product)(w, r)
+}
+
+func (s *Server) createOrder(w http.ResponseWriter, r *http.Request) {
+	productID := r.PathValue("product")
+	if _, ok := products[productID]; !ok {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+
+	var request struct {
+		Amount            map[string]int `json:"amount"`
+		CustomDescription string         `json:"custom_description"`
+		Comments          string         `json:"comments"`
+		Parent            string         `json:"parentid"`
+		Provisioning      map[string]any `json:"provisioning"`
+		PromoCodes        []string       `json:"promoCodes"`
+		Reference         string         `json:"reference"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	for _, code := range request.PromoCodes {
+		if !s.promoCodes[code] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("promo code %q is not valid", code))
+			return
+		}
+	}
+
+	order := &Order{
+		ID:           s.newID(),
+		ProductID:    productID,
+		Options:      request.Amount,
+		Provisioning: request.Provisioning,
+		Description:  request.CustomDescription,
+		Comments:     request.Comments,
+		PromoCodes:   request.PromoCodes,
+		Reference:    request.Reference,
+		BilledUntil:  time.Now().UTC().AddDate(0, 1, 0).Truncate(24 * time.Hour),
+	}
+	if order.Options == nil {
+		order.Options = map[string]int{}
+	}
+
+	if request.Parent != "" {
+		parentID, err := strconv.Atoi(request.Parent)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid parentid")
+			return
+		}
+		if _, ok := s.orders[parentID]; !ok {
+			writeError(w, http.StatusBadRequest, "parent order not found")
+			return
+		}
+		order.ParentID = parentID
+	}
+
+	if strings.HasPrefix(productID, "VM-") && s.provisioningError != "" {
+		order.ProvisioningError = s.provisioningError
+	} else if strings.HasPrefix(productID, "VM-") {
+		order.VmUUID = s.newUUID()
+		order.VmStatus = "RUNNING"
+		if s.provisioningPolls > 0 {
+			order.VmStatus = "PROVISIONING"
+			order.hiddenPolls = s.provisioningPolls
+			order.pendingPolls = s.provisioningPolls
+		}
+		if s.failedVmStatus != "" {
+			order.VmStatus = s.failedVmStatus
+			order.pendingPolls = 0
+		}
+		if ip, _ := order.Provisioning["ipaddress"].(string); ip != "" {
+			order.VmIPAddress = ip
+		} else {
+			order.VmIPAddress = fmt.Sprintf("10.0.%d.%d", order.ID/250%250, order.ID%250+1)
+		}
+		if vxlanID, _ := order.Provisioning["vxlanid"].(string); vxlanID != "" {
+			if _, ok := s.vpcs[vxlanID]; !ok {
+				writeError(w, http.StatusBadRequest, "VPC not found")
+				return
+			}
+			s.addMember(vxlanID, order.ID)
+		}
+	}
+
+	s.orders[order.ID] = order
+	if s.lostOrders > 0 {
+		s.lostOrders--
+		s.lostOrderSent = true
+		writeError(w, http.StatusGatewayTimeout, "gateway timeout")
+		return
+	}
+	writeJSON(w, map[string]any{"orderid": order.ID})
+}
+
+func (s *Server) getOrders(w http.ResponseWriter, _ *http.Request) {
+	if s.failOrderLists && s.lostOrderSent {
+		writeError(w, http.StatusServiceUnavailable, "service unavailable")
+		return
+	}
+	result := []map[string]any{}
+	for _, id := range slices.Sorted(maps.Keys(s.orders)) {
+		result = append(result, s.orderJSON(s.orders[id]))
+	}
+	writeJSON(w, map[string]any{"result": result})
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request) {
+	order := s.lookupOrder(w, r)
+	if order == nil {
+		return
+	}
+
+	response := s.orderJSON(order)
+	if order.hiddenPolls > 0 {
+		order.hiddenPolls--
+	}
+
+	writeJSON(w, map[string]any{"order": response})
+}
+
+// orderJSON returns the order as the API represents it.
+func (s *Server) orderJSON(order *Order) map[string]any {
+	needsChange := 0
+	for _, change := range s.changeRequests {
+		if change.OrderID == order.ID && !change.Applied {
+			needsChange = 1
+		}
+	}
+
+	options := []map[string]any{}
+	for _, optionID := range slices.Sorted(maps.Keys(order.Options)) {
+		optionType, ok := optionTypes[optionID]
+		if !ok {
+			optionType = "quantity"
+		}
+		options = append(options, map[string]any{
+			"orderid":     order.ID,
+			"option_id":   optionID,
+			"item_count":  order.Options[optionID],
+			"description": optionDescriptions[optionID],
+			"type":        optionType,
+		})
+	}
+
+	provisioningData := map[string]any{
+		"vm_uuid":      order.VmUUID,
+		"vm_ipaddress": order.VmIPAddress,
+	}
+	if order.hiddenPolls > 0 {
+		provisioningData = map[string]any{}
+	}
+
+	response := map[string]any{
+		"id":         order.ID,
+		"parentid":   order.ParentID,
+		"product_id": order.ProductID,
+		"options":    options,
+		"prov_options": map[string]any{
+			"amount":         order.Options,
+			"provisioning":   order.Provisioning,
+			"auto_provision": true,
+			"comments":       order.Comments,
+		},
+		"prov_data":          provisioningData,
+		"billed_until":       order.BilledUntil.Format(billedUntilFormat),
+		"needs_change":       needsChange,
+		"custom_description": order.Description,
+		"reference":          order.Reference,
+		"provisionerror":     order.ProvisioningError,
+	}
+	if order.EndDate != "" {
+		response["end_date"] = order.EndDate
+	}
+	return response
+}
+
+func (s *Server) changeOrder(w http.ResponseWriter, r *http.Request) {
+	order := s.lookupOrder(w, r)
+	if order == nil {
+		return
+	}
+
+	var request struct {
+		Options       map[string]int `json:"options"`
+		ScheduledDate string         `json:"scheduled_date"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if len(request.Options) == 0 {
+		writeError(w, http.StatusBadRequest, "no options to change")
+		return
+	}
+
+	change := &ChangeRequest{
+		ID:            s.newID(),
+		OrderID:       order.ID,
+		Options:       request.Options,
+		ScheduledDate: request.ScheduledDate,
+	}
+	s.changeRequests = append(s.changeRequests, change)
+	switch {
+	case s.changeError != "":
+		change.ProvisioningError = s.changeError
+	case s.holdChanges || change.ScheduledDate != "":
+		// applied by ApplyChanges
+	case s.changePolls > 0:
+		change.pendingPolls = s.changePolls
+	default:
+		s.applyChange(change)
+	}
+
+	if s.omitChangeIDs {
+		writeSuccess(w)
+		return
+	}
+	writeJSON(w, map[string]any{"success": true, "changerequestid": change.ID})
+}
+
+func (s *Server) getChangeRequests(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.URL.Query().Get("orderId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid orderId")
+		return
+	}
+
+	result := []map[string]any{}
+	for _, change := range s.changeRequests {
+		if change.OrderID != orderID || change.Applied {
+			continue
+		}
+		if change.pendingPolls > 0 {
+			change.pendingPolls--
+			if change.pendingPolls == 0 {
+				s.applyChange(change)
+				continue
+			}
+		}
+		newOptions, err := json.Marshal(change.Options)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		result = append(result, map[string]any{
+			"id":                       change.ID,
+			"order_id":                 change.OrderID,
+			"scheduled_date":           change.ScheduledDate,
+			"new_option":               string(newOptions),
+			"provisionerror":           change.ProvisioningError,
+			"isprovisionerrorinternal": 0,
+		})
+	}
+
+	writeJSON(w, map[string]any{"result": result})
+}
+
+func (s *Server) endOrder(w http.ResponseWriter, r *http.Request) {
+	order := s.lookupOrder(w, r)
+	if order == nil {
+		return
+	}
+
+	var request struct {
+		EndDate          string `json:"end_date"`
+		IncludeSubOrders bool   `json:"includeSubOrders"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if _, err := time.Parse(time.DateOnly, request.EndDate); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid end_date, expected YYYY-MM-DD")
+		return
+	}
+
+	order.EndDate = request.EndDate
+	if request.IncludeSubOrders {
+		for _, child := range s.orders {
+			if child.ParentID == order.ID && child.EndDate == "" {
+				child.EndDate = request.EndDate
+			}
+		}
+	}
+
+	writeSuccess(w)
+}
+
+func (s *Server) getVmState(w http.ResponseWriter, r *http.Request) {
+	order := s.lookupVm(w, r)
+	if order == nil {
+		return
+	}
+	status := order.VmStatus
+	if order.pendingPolls > 0 {
+		order.pendingPolls--
+		if order.pendingPolls == 0 {
+			order.VmStatus = "RUNNING"
+		}
+	}
+
+	writeJSON(w, map[string]any{"vm": map[string]any{
+		"id":     order.VmUUID,
+		"status": status,
+		"vmname": fmt.Sprintf("vm%d", order.ID),
+	}})
+}
+
+func (s *Server) changeVmState(w http.ResponseWriter, r *http.Request) {
+	order := s.lookupVm(w, r)
+	if order == nil {
+		return
+	}
+
+	switch r.PathValue("state") {
+	case "on":
+		order.VmStatus = "RUNNING"
+	case "off":
+		order.VmStatus = "STOPPED"
+	default:
+		writeError(w, http.StatusBadRequest, "unknown state")
+		return
+	}
+
+	writeSuccess(w)
+}
+
+func (s *Server) getVpcs(w http.ResponseWriter, _ *http.Request) {
+	vpcs := []map[string]any{}
+	for _, vpc := range s.sortedVpcs() {
+		vpcs = append(vpcs, vpcJSON(vpc))
+	}
+	writeJSON(w, map[string]any{"vxlan": vpcs})
+}
+
+func (s *Server) createVpc(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Label string `json:"label"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if request.Label == "" {
+		writeError(w, http.StatusBadRequest, "label is required")
+		return
+	}
+
+	number := 100
+	for _, vpc := range s.vpcs {
+		number = max(number, vpc.Number+1)
+	}
+	vpc := &Vpc{ID: s.newUUID(), Number: number, Label: request.Label}
+	s.vpcs[vpc.ID] = vpc
+
+	writeJSON(w, map[string]any{"id": vpc.ID})
+}
+
+func (s *Server) getVpcMembers(w http.ResponseWriter, _ *http.Request) {
+	members := []map[string]any{}
+	for _, member := range s.members {
+		members = append(members, map[string]any{
+			"id":         member.ID,
+			"vxlan":      s.vpcs[member.VpcID].Number,
+			"macaddress": member.MacAddress,
+			"orderid":    member.OrderID,
+		})
+	}
+	writeJSON(w, map[string]any{"members": members})
+}
+
+func (s *Server) getVpc(w http.ResponseWriter, r *http.Request) {
+	vpc := s.lookupVpc(w, r)
+	if vpc == nil {
+		return
+	}
+	writeJSON(w, map[string]any{"vxlan": vpcJSON(vpc)})
+}
+
+func (s *Server) updateVpc(w http.ResponseWriter, r *http.Request) {
+	vpc := s.lookupVpc(w, r)
+	if vpc == nil {
+		return
+	}
+
+	var request struct {
+		Label string `json:"label"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if request.Label == "" {
+		writeError(w, http.StatusBadRequest, "label is required")
+		return
+	}
+	vpc.Label = request.Label
+
+	writeSuccess(w)
+}
+
+func (s *Server) deleteVpc(w http.ResponseWriter, r *http.Request) {
+	vpc := s.lookupVpc(w, r)
+	if vpc == nil {
+		return
+	}
+
+	for _, member := range s.members {
+		if member.VpcID == vpc.ID {
+			writeError(w, http.StatusConflict, "VPC still has members")
+			return
+		}
+	}
+	delete(s.vpcs, vpc.ID)
+
+	writeSuccess(w)
+}
+
+func (s *Server) addVpcMember(w http.ResponseWriter, r *http.Request) {
+	vpc := s.lookupVpc(w, r)
+	if vpc == nil {
+		return
+	}
+
+	var request struct {
+		OrderID int `json:"orderid"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if _, ok := s.orders[request.OrderID]; !ok {
+		writeError(w, http.StatusBadRequest, "order not found")
+		return
+	}
+	for _, member := range s.members {
+		if member.VpcID == vpc.ID && member.OrderID == request.OrderID {
+			writeError(w, http.StatusConflict, "order is already a member of this VPC")
+			return
+		}
+	}
+
+	member := s.addMember(vpc.ID, request.OrderID)
+	writeJSON(w, map[string]any{"id": member.ID})
+}
+
+func (s *Server) removeVpcMember(w http.ResponseWriter, r *http.Request) {
+	vpc := s.lookupVpc(w, r)
+	if vpc == nil {
+		return
+	}
+
+	var request struct {
+		OrderID int `json:"orderid"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	for i, member := range s.members {
+		if member.VpcID == vpc.ID && member.OrderID == request.OrderID {
+			s.members = slices.Delete(s.members, i, i+1)
+			writeJSON(w, map[string]any{"remoteId": member.ID})
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "order is not a member of this VPC")
+}
+
+// applyChange merges the options of a change request into its order.
+func (s *Server) applyChange(change *ChangeRequest) {
+	if change.Applied {
+		return
+	}
+	if order, ok := s.orders[change.OrderID]; ok {
+		for optionID, count := range change.Options {
+			if count == 0 && optionTypes[optionID] == "flag" {
+				delete(order.Options, optionID)
+				continue
+			}
+			order.Options[optionID] = count
+		}
+	}
+	change.Applied = true
+}
+
+func (s *Server) addMember(vpcID string, orderID int) *VpcMember {
+	id := s.newID()
+	member := &VpcMember{
+		ID:         s.newUUID(),
+		VpcID:      vpcID,
+		OrderID:    orderID,
+		MacAddress: fmt.Sprintf("52:54:00:%02x:%02x:%02x", id>>16&0xff, id>>8&0xff, id&0xff),
+	}
+	s.members = append(s.members, member)
+	return member
+}
+
+func (s *Server) lookupOrder(w http.ResponseWriter, r *http.Request) *Order {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "order not found")
+		return nil
+	}
+	order, ok := s.orders[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "order not found")
+		return nil
+	}
+	return order
+}
+
+func (s *Server) lookupVm(w http.ResponseWriter, r *http.Request) *Order {
+	uuid := r.PathValue("uuid")
+	for _, order := range s.orders {
+		if order.VmUUID != "" && order.VmUUID == uuid {
+			return order
+		}
+	}
+	writeError(w, http.StatusNotFound, "VM not found")
+	return nil
+}
+
+func (s *Server) lookupVpc(w http.ResponseWriter, r *http.Request) *Vpc {
+	vpc, ok := s.vpcs[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "VPC not found")
+		return nil
+	}
+	return vpc
+}
+
+func (s *Server) sortedVpcs() []*Vpc {
+	vpcs := slices.Collect(maps.Values(s.vpcs))
+	slices.SortFunc(vpcs, func(a, b *Vpc) int { return a.Number - b.Number })
+	return vpcs
+}
+
+func (s *Server) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) newUUID() string {
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", s.newID())
+}
+
+func vpcJSON(vpc *Vpc) map[string]any {
+	return map[string]any{
+		"id":                  vpc.ID,
+		"vxlan":               vpc.Number,
+		"label":               vpc.Label,
+		"ownerid":             1,
+		"removablebycustomer": 1,
+	}
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v without a trailing newline, as the client compares
+// some responses verbatim.
+func writeJSON(w http.ResponseWriter, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func writeSuccess(w http.ResponseWriter) {
+	writeJSON(w, map[string]any{"success": true})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	body, _ := json.Marshal(map[string]any{"error": message})
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,307 @@
+package newvmtest_test
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+)
+
+func newClient(t *testing.T, s *newvmtest.Server) *newvm.Client {
+	t.Helper()
+
+	client, err := newvm.NewClient(context.Background(), &s.URL, &s.Username, &s.Password, nil)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestServerRejectsInvalidCredentials(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	password := "wrong"
+
+	_, err := newvm.NewClient(context.Background(), &s.URL, &s.Username, &password, nil, newvm.WithRetryPolicy(newvm.RetryPolicy{MaxAttempts: 1}))
+	if err == nil {
+		t.Fatal("expected login to fail")
+	}
+}
+
+func TestServerCatalog(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t, newvmtest.NewServer(t))
+
+	vmProducts, err := client.GetVmProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetVmProducts: %v", err)
+	}
+	if len(vmProducts) != 5 || vmProducts[1].ID != "VM-A2" || vmProducts[1].Ram != 2 || vmProducts[1].Price != 10 {
+		t.Fatalf("unexpected VM products: %+v", vmProducts)
+	}
+
+	controlPanelProducts, err := client.GetControlPanelProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetControlPanelProducts: %v", err)
+	}
+	if len(controlPanelProducts) != 6 || controlPanelProducts[3].ID != "CP_PLESK.plesk_12_license.0" {
+		t.Fatalf("unexpected control panel products: %+v", controlPanelProducts)
+	}
+	if len(controlPanelProducts[3].Extensions) != 4 {
+		t.Fatalf("expected 4 Plesk extensions, got %+v", controlPanelProducts[3].Extensions)
+	}
+
+	locations, err := client.GetLocations(ctx)
+	if err != nil {
+		t.Fatalf("GetLocations: %v", err)
+	}
+	if len(locations) != 2 {
+		t.Fatalf("expected only the provisionable locations, got %+v", locations)
+	}
+}
+
+func TestServerVmLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newClient(t, s)
+
+	vpc, err := client.CreateVpc(ctx, newvm.Vpc{Name: "backend"})
+	if err != nil {
+		t.Fatalf("CreateVpc: %v", err)
+	}
+	vpc, err = client.GetVpc(ctx, vpc.ID)
+	if err != nil {
+		t.Fatalf("GetVpc: %v", err)
+	}
+
+	created, err := client.CreateVm(ctx, newvm.Vm{
+		VmProductID: "VM-A2",
+		Os:          "debian-12",
+		Hostname:    "web1.example.com",
+		Location:    "AMS1",
+		Ram:         2,
+		Vpc:         []int32{vpc.Number},
+		UseDhcp:     true,
+	})
+	if err != nil {
+		t.Fatalf("CreateVm: %v", err)
+	}
+	orderID := strconv.Itoa(created.OrderID)
+
+	vm, err := client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	if vm.VmProductID != "VM-A2" || vm.Os != "debian-12" || vm.Location != "AMS1" || vm.Ram != 2 {
+		t.Fatalf("unexpected VM: %+v", vm)
+	}
+	if !slices.Equal(vm.Vpc, []int32{vpc.Number}) {
+		t.Fatalf("expected VM in VPC %d, got %v", vpc.Number, vm.Vpc)
+	}
+
+	// resize through a change request that stays pending
+	s.HoldChanges(true)
+	resized := *vm
+	resized.Cores = 2
+	pendingCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.UpdateVm(pendingCtx, orderID, vm, resized); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("UpdateVm: expected to time out waiting for the pending change, got %v", err)
+	}
+	vm, err = client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	if vm.Cores != 2 {
+		t.Fatalf("expected the pending change, got %+v", vm)
+	}
+	s.ApplyChanges()
+	if order, _ := s.Order(created.OrderID); order.Options["vm_core"] != 2 {
+		t.Fatalf("expected the change to be applied, got %v", order.Options)
+	}
+
+	// detach the VPC, which needs no change request
+	detached := *vm
+	detached.Vpc = nil
+	if _, err := client.UpdateVm(ctx, orderID, vm, detached); err != nil {
+		t.Fatalf("UpdateVm: %v", err)
+	}
+	vm, err = client.GetVm(ctx, orderID)
+	if err != nil {
+		t.Fatalf("GetVm: %v", err)
+	}
+	if len(vm.Vpc) != 0 {
+		t.Fatalf("expected the detached VPC, got %+v", vm)
+	}
+
+	// sessions are renewed transparently
+	s.ExpireTokens()
+
+	if _, err := client.DeleteVm(ctx, orderID, newvm.DeletionPolicyEndOfBillingPeriod, false); err != nil {
+		t.Fatalf("DeleteVm: %v", err)
+	}
+	order, _ := s.Order(created.OrderID)
+	if order.EndDate == "" || order.VmStatus != "STOPPED" {
+		t.Fatalf("expected the VM to be stopped and ended, got %+v", order)
+	}
+
+	if err := client.DeleteVpc(ctx, vpc.ID); err != nil {
+		t.Fatalf("DeleteVpc: %v", err)
+	}
+	if _, ok := s.Vpc(int(vpc.Number)); ok {
+		t.Fatal("expected the VPC to be deleted")
+	}
+}
+
+func TestServerCreateVmWithoutVpc(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newClient(t, s)
+
+	// vpc is optional, a VM without one must not index an empty list
+	created, err := client.CreateVm(ctx, newvm.Vm{VmProductID: "VM-A1", Os: "debian-12", Hostname: "web1.example.com"})
+	if err != nil {
+		t.Fatalf("CreateVm: %v", err)
+	}
+	if vpcs := s.VpcMembers(created.OrderID); len(vpcs) != 0 {
+		t.Fatalf("expected the VM outside any VPC, got %v", vpcs)
+	}
+}
+
+func TestServerDeleteVmLeavesVpcs(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newClient(t, s)
+
+	vpc, err := client.CreateVpc(ctx, newvm.Vpc{Name: "backend"})
+	if err != nil {
+		t.Fatalf("CreateVpc: %v", err)
+	}
+	vpc, err = client.GetVpc(ctx, vpc.ID)
+	if err != nil {
+		t.Fatalf("GetVpc: %v", err)
+	}
+	created, err := client.CreateVm(ctx, newvm.Vm{VmProductID: "VM-A1", Os: "debian-12", Hostname: "web1.example.com", Vpc: []int32{vpc.Number}})
+	if err != nil {
+		t.Fatalf("CreateVm: %v", err)
+	}
+
+	// a VPC with members cannot be deleted, so destroying both in one
+	// run requires the VM to leave its VPCs
+	if _, err := client.DeleteVm(ctx, strconv.Itoa(created.OrderID), newvm.DeletionPolicyEndOfBillingPeriod, false); err != nil {
+		t.Fatalf("DeleteVm: %v", err)
+	}
+	if vpcs := s.VpcMembers(created.OrderID); len(vpcs) != 0 {
+		t.Fatalf("expected the VM to leave its VPCs, got %v", vpcs)
+	}
+	if err := client.DeleteVpc(ctx, vpc.ID); err != nil {
+		t.Fatalf("DeleteVpc: %v", err)
+	}
+}
+
+func TestServerGetControlPanel(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newClient(t, s)
+
+	vm, err := client.CreateVm(ctx, newvm.Vm{VmProductID: "VM-A1", Os: "debian-12", Hostname: "cp.example.com"})
+	if err != nil {
+		t.Fatalf("CreateVm: %v", err)
+	}
+
+	// every case of the license and extension switches is read back,
+	// not only the last one
+	tests := []newvm.ControlPanel{
+		{VmID: vm.OrderID, ProductID: "CP_DIRECTADMIN.da_license.1"},
+		{VmID: vm.OrderID, ProductID: "CP_PLESK.plesk_12_license.1", Extensions: []newvm.ControlPanelExtension{{ID: "plesk_extension_dnssec"}}},
+	}
+	for _, test := range tests {
+		created, err := client.CreateControlPanel(ctx, test)
+		if err != nil {
+			t.Fatalf("CreateControlPanel: %v", err)
+		}
+		controlPanel, err := client.GetControlPanel(ctx, int64(created.ID))
+		if err != nil {
+			t.Fatalf("GetControlPanel: %v", err)
+		}
+		if controlPanel.ProductID != test.ProductID {
+			t.Fatalf("expected product ID %q, got %q", test.ProductID, controlPanel.ProductID)
+		}
+		ids := []string{}
+		for _, extension := range controlPanel.Extensions {
+			ids = append(ids, extension.ID)
+		}
+		expected := []string{}
+		for _, extension := range test.Extensions {
+			expected = append(expected, extension.ID)
+		}
+		if !slices.Equal(ids, expected) {
+			t.Fatalf("%s: expected extensions %v, got %v", test.ProductID, expected, ids)
+		}
+	}
+}
+
+func TestServerUpdateControlPanelRemovesExtensions(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newClient(t, s)
+
+	vm, err := client.CreateVm(ctx, newvm.Vm{VmProductID: "VM-A1", Os: "debian-12", Hostname: "cp.example.com"})
+	if err != nil {
+		t.Fatalf("CreateVm: %v", err)
+	}
+	controlPanel, err := client.CreateControlPanel(ctx, newvm.ControlPanel{
+		VmID:       vm.OrderID,
+		ProductID:  "CP_PLESK.plesk_12_license.1",
+		Extensions: []newvm.ControlPanelExtension{{ID: "plesk_extension_dnssec"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateControlPanel: %v", err)
+	}
+
+	// swapping an extension must remove the one no longer listed
+	controlPanel.Extensions = []newvm.ControlPanelExtension{{ID: "plesk_extension_hosting_pack"}}
+	if _, err := client.UpdateControlPanel(ctx, int64(controlPanel.ID), *controlPanel); err != nil {
+		t.Fatalf("UpdateControlPanel: %v", err)
+	}
+	order, _ := s.Order(controlPanel.ID)
+	if order.Options["plesk_extension_dnssec"] != 0 || order.Options["plesk_extension_hosting_pack"] != 1 {
+		t.Fatalf("expected only the hosting pack extension, got %v", order.Options)
+	}
+}
+
+func TestServerControlPanelLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := newvmtest.NewServer(t)
+	client := newClient(t, s)
+
+	vm, err := client.CreateVm(ctx, newvm.Vm{VmProductID: "VM-A1", Os: "debian-12", Hostname: "cp.example.com"})
+	if err != nil {
+		t.Fatalf("CreateVm: %v", err)
+	}
+
+	controlPanel, err := client.CreateControlPanel(ctx, newvm.ControlPanel{
+		VmID:       vm.OrderID,
+		ProductID:  "CP_PLESK.plesk_12_license.1",
+		Extensions: []newvm.ControlPanelExtension{{ID: "plesk_extension_dnssec"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateControlPanel: %v", err)
+	}
+
+	order, _ := s.Order(controlPanel.ID)
+	if order.ParentID != vm.OrderID || order.Options["plesk_12_license"] != 1 || order.Options["plesk_extension_dnssec"] != 1 {
+		t.Fatalf("unexpected control panel order: %+v", order)
+	}
+
+	if _, err := client.DeleteVm(ctx, strconv.Itoa(vm.OrderID), newvm.DeletionPolicyEndOfBillingPeriod, true); err != nil {
+		t.Fatalf("DeleteVm: %v", err)
+	}
+	if order, _ := s.Order(controlPanel.ID); order.EndDate == "" {
+		t.Fatal("expected the control panel to end with its VM")
+	}
+}
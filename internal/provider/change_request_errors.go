@@ -0,0 +1,30 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+
+	"unithost-terraform/internal/newvm"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+)
+
+// addUpdateError reports a failed update. When NewVM could not apply the
+// change request, the provisioning error is attached to the changed
+// attributes, any other error is reported for the whole resource.
+func addUpdateError(diags *diag.Diagnostics, summary, detail string, err error, changed []path.Path) {
+	var changeErr *newvm.ChangeRequestError
+	if !errors.As(err, &changeErr) || len(changed) == 0 {
+		diags.AddError(summary, detail+err.Error())
+		return
+	}
+
+	detail = fmt.Sprintf("NewVM could not apply change request %d of order %d: %s", changeErr.ChangeRequestID, changeErr.OrderID, changeErr.Message)
+	if changeErr.Internal {
+		detail += "\n\nThis is an error on the NewVM side, not in the configuration. Try again later or contact NewVM support."
+	}
+	for _, attrPath := range changed {
+		diags.AddAttributeError(attrPath, summary, detail)
+	}
+}
@@ -24,7 +24,7 @@ func NewControlPanelProductsDataSource() datasource.DataSource {
 
 // controlPanelProductsDataSource is the data source implementation.
 type controlPanelProductsDataSource struct {
-	client *newvm.Client
+	client newvm.API
 }
 
 // controlPanelProductsDataSourceModel maps the data source schema data.
@@ -114,7 +114,7 @@ func (d *controlPanelProductsDataSource) Read(ctx context.Context, req datasourc
 		return
 	}
 
-	controlPanelProducts, err := d.client.GetControlPanelProducts()
+	controlPanelProducts, err := d.client.GetControlPanelProducts(ctx)
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Unable to read NewVM Control panel products",
@@ -163,11 +163,11 @@ func (d *controlPanelProductsDataSource) Configure(_ context.Context, req dataso
 		return
 	}
 
-	client, ok := req.ProviderData.(*newvm.Client)
+	client, ok := req.ProviderData.(newvm.API)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *newvm.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected newvm.API, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
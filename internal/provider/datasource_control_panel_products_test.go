@@ -0,0 +1,36 @@
+package provider
+
+import (
+	"testing"
+
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccControlPanelProductsDataSource(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: s.ProviderConfig() + `
+data "newvm_control_panel_products" "all" {}
+
+data "newvm_control_panel_products" "plesk" {
+  id = "CP_PLESK.plesk_12_license.1"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.newvm_control_panel_products.all", "list.#", "6"),
+					resource.TestCheckResourceAttr("data.newvm_control_panel_products.plesk", "list.#", "1"),
+					resource.TestCheckResourceAttr("data.newvm_control_panel_products.plesk", "list.0.type", "web_pro"),
+					resource.TestCheckResourceAttr("data.newvm_control_panel_products.plesk", "list.0.description", "Plesk: Web Pro Edition"),
+					resource.TestCheckResourceAttr("data.newvm_control_panel_products.plesk", "list.0.price", "18"),
+					resource.TestCheckResourceAttr("data.newvm_control_panel_products.plesk", "list.0.extensions.#", "4"),
+				),
+			},
+		},
+	})
+}
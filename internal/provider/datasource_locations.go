@@ -24,7 +24,7 @@ func NewLocationsDataSource() datasource.DataSource {
 
 // locationsDataSource is the data source implementation.
 type locationsDataSource struct {
-	client *newvm.Client
+	client newvm.API
 }
 
 // locationsDataSourceModel maps the data source schema data.
@@ -88,7 +88,7 @@ func (d *locationsDataSource) Read(ctx context.Context, req datasource.ReadReque
 		return
 	}
 
-	locations, err := d.client.GetLocations()
+	locations, err := d.client.GetLocations(ctx)
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Unable to read NewVM locations",
@@ -132,11 +132,11 @@ func (d *locationsDataSource) Configure(_ context.Context, req datasource.Config
 		return
 	}
 
-	client, ok := req.ProviderData.(*newvm.Client)
+	client, ok := req.ProviderData.(newvm.API)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *newvm.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected newvm.API, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestLocationsDataSourceFiltersByCode(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI()
+	api.locations = []newvm.Location{
+		{ID: "1", Name: "Amsterdam", Code: "AMS1", ProductIds: []string{"VM-A1"}},
+		{ID: "2", Name: "Rotterdam", Code: "RTM1"},
+	}
+	d := &locationsDataSource{client: api}
+
+	var schemaResp datasource.SchemaResponse
+	d.Schema(ctx, datasource.SchemaRequest{}, &schemaResp)
+	s := schemaResp.Schema
+
+	config := tfsdk.Config{Schema: s, Raw: tftypes.NewValue(s.Type().TerraformType(ctx), nil)}
+	// tfsdk.Config has no Set, so build it through a state of the same schema
+	configState := tfsdk.State{Schema: s, Raw: config.Raw}
+	if diags := configState.Set(ctx, locationsDataSourceModel{Code: types.StringValue("RTM1")}); diags.HasError() {
+		t.Fatalf("unable to set config: %v", diags.Errors())
+	}
+	config.Raw = configState.Raw
+
+	resp := datasource.ReadResponse{State: tfsdk.State{Schema: s, Raw: tftypes.NewValue(s.Type().TerraformType(ctx), nil)}}
+	d.Read(ctx, datasource.ReadRequest{Config: config}, &resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read: %v", resp.Diagnostics.Errors())
+	}
+
+	var state locationsDataSourceModel
+	resp.State.Get(ctx, &state)
+	if len(state.Locations) != 1 || state.Locations[0].Name.ValueString() != "Rotterdam" {
+		t.Fatalf("Read: expected only Rotterdam, got %+v", state.Locations)
+	}
+}
+
+func TestAccLocationsDataSource(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: s.ProviderConfig() + `
+data "newvm_locations" "all" {}
+
+data "newvm_locations" "amsterdam" {
+  code = "AMS1"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					// only provisionable locations are listed
+					resource.TestCheckResourceAttr("data.newvm_locations.all", "list.#", "2"),
+					resource.TestCheckResourceAttr("data.newvm_locations.amsterdam", "list.#", "1"),
+					resource.TestCheckResourceAttr("data.newvm_locations.amsterdam", "list.0.name", "Amsterdam"),
+					resource.TestCheckResourceAttr("data.newvm_locations.amsterdam", "list.0.product_ids.#", "2"),
+				),
+			},
+		},
+	})
+}
@@ -24,7 +24,7 @@ func NewOperatingSystemsDataSource() datasource.DataSource {
 
 // operatingSystemsDataSource is the data source implementation.
 type operatingSystemsDataSource struct {
-	client *newvm.Client
+	client newvm.API
 }
 
 // operatingSystemsDataSourceModel maps the data source schema data.
@@ -91,7 +91,7 @@ func (d *operatingSystemsDataSource) Read(ctx context.Context, req datasource.Re
 		return
 	}
 
-	operatingSystems, err := d.client.GetOperatingSystems()
+	operatingSystems, err := d.client.GetOperatingSystems(ctx)
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Unable to read NewVM operating systems",
@@ -132,11 +132,11 @@ func (d *operatingSystemsDataSource) Configure(_ context.Context, req datasource
 		return
 	}
 
-	client, ok := req.ProviderData.(*newvm.Client)
+	client, ok := req.ProviderData.(newvm.API)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *newvm.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected newvm.API, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
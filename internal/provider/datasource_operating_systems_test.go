@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"testing"
+
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccOperatingSystemsDataSource(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: s.ProviderConfig() + `
+data "newvm_operating_systems" "all" {}
+
+data "newvm_operating_systems" "debian" {
+  tag = "debian-12"
+}
+
+data "newvm_operating_systems" "windows" {
+  platform = "windows"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.newvm_operating_systems.all", "list.#", "3"),
+					resource.TestCheckResourceAttr("data.newvm_operating_systems.debian", "list.#", "1"),
+					resource.TestCheckResourceAttr("data.newvm_operating_systems.debian", "list.0.name", "Debian 12"),
+					resource.TestCheckResourceAttr("data.newvm_operating_systems.windows", "list.#", "1"),
+					resource.TestCheckResourceAttr("data.newvm_operating_systems.windows", "list.0.tag", "windows-2022"),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,250 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"unithost-terraform/internal/newvm"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ datasource.DataSource              = &ordersDataSource{}
+	_ datasource.DataSourceWithConfigure = &ordersDataSource{}
+)
+
+// NewOrdersDataSource is a helper function to simplify the provider implementation.
+func NewOrdersDataSource() datasource.DataSource {
+	return &ordersDataSource{}
+}
+
+// ordersDataSource is the data source implementation.
+type ordersDataSource struct {
+	client newvm.API
+}
+
+// ordersDataSourceModel maps the data source schema data.
+type ordersDataSourceModel struct {
+	ProductFamily   types.String `tfsdk:"product_family"`
+	ParentID        types.Int64  `tfsdk:"parent_id"`
+	NeedsChange     types.Bool   `tfsdk:"needs_change"`
+	BilledUntilFrom types.String `tfsdk:"billed_until_from"`
+	BilledUntilTo   types.String `tfsdk:"billed_until_to"`
+	Orders          []orderModel `tfsdk:"list"`
+}
+
+// orderModel maps order schema data.
+type orderModel struct {
+	ID          types.Int64  `tfsdk:"id"`
+	ParentID    types.Int64  `tfsdk:"parent_id"`
+	ProductID   types.String `tfsdk:"product_id"`
+	Options     types.Map    `tfsdk:"options"`
+	VmUuid      types.String `tfsdk:"vm_uuid"`
+	VmIpAddress types.String `tfsdk:"vm_ip_address"`
+	NeedsChange types.Bool   `tfsdk:"needs_change"`
+	BilledUntil types.String `tfsdk:"billed_until"`
+	EndDate     types.String `tfsdk:"end_date"`
+}
+
+// Metadata returns the data source type name.
+func (d *ordersDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_orders"
+}
+
+// Schema defines the schema for the data source.
+func (d *ordersDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Lists the orders of the account.",
+		Attributes: map[string]schema.Attribute{
+			"product_family": schema.StringAttribute{
+				Description: "Only list orders of this product family, e.g. VM-A or CP_PLESK.",
+				Optional:    true,
+			},
+			"parent_id": schema.Int64Attribute{
+				Description: "Only list orders placed under this parent order, e.g. the control panels of a VM.",
+				Optional:    true,
+			},
+			"needs_change": schema.BoolAttribute{
+				Description: "Only list orders with (true) or without (false) outstanding change requests.",
+				Optional:    true,
+			},
+			"billed_until_from": schema.StringAttribute{
+				Description: "Only list orders billed until this time or later, as an RFC 3339 timestamp or a YYYY-MM-DD date (midnight UTC).",
+				Optional:    true,
+			},
+			"billed_until_to": schema.StringAttribute{
+				Description: "Only list orders billed until this time or earlier, as an RFC 3339 timestamp or a YYYY-MM-DD date (midnight UTC).",
+				Optional:    true,
+			},
+			"list": schema.ListNestedAttribute{
+				Computed: true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"id": schema.Int64Attribute{
+							Computed: true,
+						},
+						"parent_id": schema.Int64Attribute{
+							Description: "ID of the parent order, 0 for top-level orders.",
+							Computed:    true,
+						},
+						"product_id": schema.StringAttribute{
+							Computed: true,
+						},
+						"options": schema.MapAttribute{
+							Description: "Item count of each ordered option, by option ID.",
+							ElementType: types.Int64Type,
+							Computed:    true,
+						},
+						"vm_uuid": schema.StringAttribute{
+							Description: "UUID of the provisioned VM, empty for other orders and while provisioning.",
+							Computed:    true,
+						},
+						"vm_ip_address": schema.StringAttribute{
+							Description: "IP address of the provisioned VM.",
+							Computed:    true,
+						},
+						"needs_change": schema.BoolAttribute{
+							Description: "Whether the order has outstanding change requests.",
+							Computed:    true,
+						},
+						"billed_until": schema.StringAttribute{
+							Description: "End of the period the order is billed for.",
+							Computed:    true,
+						},
+						"end_date": schema.StringAttribute{
+							Description: "Date the order ends, empty while it runs.",
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (d *ordersDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	state := ordersDataSourceModel{}
+
+	// Get the config values (the filters)
+	diags := req.Config.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var billedFrom, billedTo time.Time
+	if !state.BilledUntilFrom.IsNull() {
+		billedFrom = parseBilledUntilFilter(state.BilledUntilFrom.ValueString(), path.Root("billed_until_from"), &resp.Diagnostics)
+	}
+	if !state.BilledUntilTo.IsNull() {
+		billedTo = parseBilledUntilFilter(state.BilledUntilTo.ValueString(), path.Root("billed_until_to"), &resp.Diagnostics)
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	orders, err := d.client.GetAllOrders(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to read NewVM orders",
+			err.Error(),
+		)
+		return
+	}
+
+	// Map response body to model
+	filtered := []orderModel{}
+	for _, order := range orders {
+		if !state.ProductFamily.IsNull() && order.ProductID != state.ProductFamily.ValueString() {
+			continue
+		}
+		if !state.ParentID.IsNull() && int64(order.ParentID) != state.ParentID.ValueInt64() {
+			continue
+		}
+		if !state.NeedsChange.IsNull() && (order.NeedsChange != 0) != state.NeedsChange.ValueBool() {
+			continue
+		}
+		if !billedFrom.IsZero() || !billedTo.IsZero() {
+			billedUntil, err := order.BilledUntilTime()
+			if err != nil || (!billedFrom.IsZero() && billedUntil.Before(billedFrom)) || (!billedTo.IsZero() && billedUntil.After(billedTo)) {
+				continue
+			}
+		}
+
+		options := map[string]int64{}
+		for _, option := range order.Options {
+			options[option.OptionID] = int64(option.ItemCount)
+		}
+		optionsValue, diags := types.MapValueFrom(ctx, types.Int64Type, options)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+
+		filtered = append(filtered, orderModel{
+			ID:          types.Int64Value(int64(order.ID)),
+			ParentID:    types.Int64Value(int64(order.ParentID)),
+			ProductID:   types.StringValue(order.ProductID),
+			Options:     optionsValue,
+			VmUuid:      types.StringValue(order.ProvisioningData.VmUuid),
+			VmIpAddress: types.StringValue(order.ProvisioningData.VmIpAddress),
+			NeedsChange: types.BoolValue(order.NeedsChange != 0),
+			BilledUntil: types.StringValue(order.BilledUntil),
+			EndDate:     types.StringValue(order.EndDate),
+		})
+	}
+	state.Orders = filtered
+
+	// Set state
+	diags = resp.State.Set(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+}
+
+// parseBilledUntilFilter parses a billed_until bound, which is either an
+// RFC 3339 timestamp or a date.
+func parseBilledUntilFilter(value string, attrPath path.Path, diags *diag.Diagnostics) time.Time {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t
+	}
+	diags.AddAttributeError(
+		attrPath,
+		"Invalid Billing Date",
+		fmt.Sprintf("Expected an RFC 3339 timestamp or a YYYY-MM-DD date, got %q.", value),
+	)
+	return time.Time{}
+}
+
+// Configure adds the provider configured client to the data source.
+func (d *ordersDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Add a nil check when handling ProviderData because Terraform
+	// sets that data after it calls the ConfigureProvider RPC.
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(newvm.API)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected newvm.API, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	d.client = client
+}
@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccOrdersDataSource(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	today := time.Now().UTC().Format(time.DateOnly)
+	inTwoMonths := time.Now().UTC().AddDate(0, 2, 0).Format(time.DateOnly)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product  = "VM-A2"
+  os       = "debian-12"
+  hostname = "web1.example.com"
+}
+
+resource "newvm_control_panel" "plesk" {
+  vm_id      = newvm_vm.web.id
+  product_id = "CP_PLESK.plesk_12_license.1"
+}
+
+data "newvm_orders" "all" {
+  depends_on = [newvm_control_panel.plesk]
+}
+
+data "newvm_orders" "vms" {
+  product_family = "VM-A"
+  depends_on     = [newvm_control_panel.plesk]
+}
+
+data "newvm_orders" "children" {
+  parent_id  = newvm_vm.web.id
+  depends_on = [newvm_control_panel.plesk]
+}
+
+data "newvm_orders" "changing" {
+  needs_change = true
+  depends_on   = [newvm_control_panel.plesk]
+}
+
+data "newvm_orders" "billed_next_month" {
+  billed_until_from = %q
+  billed_until_to   = %q
+  depends_on        = [newvm_control_panel.plesk]
+}
+
+data "newvm_orders" "billed_today" {
+  billed_until_to = %q
+  depends_on      = [newvm_control_panel.plesk]
+}
+`, today, inTwoMonths, today),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.newvm_orders.all", "list.#", "2"),
+					resource.TestCheckResourceAttr("data.newvm_orders.vms", "list.#", "1"),
+					resource.TestCheckResourceAttrPair("data.newvm_orders.vms", "list.0.id", "newvm_vm.web", "id"),
+					resource.TestCheckResourceAttr("data.newvm_orders.vms", "list.0.product_id", "VM-A"),
+					resource.TestCheckResourceAttr("data.newvm_orders.vms", "list.0.parent_id", "0"),
+					resource.TestCheckResourceAttrPair("data.newvm_orders.vms", "list.0.vm_uuid", "newvm_vm.web", "uuid"),
+					resource.TestCheckResourceAttrPair("data.newvm_orders.vms", "list.0.vm_ip_address", "newvm_vm.web", "ip_address"),
+					resource.TestCheckResourceAttr("data.newvm_orders.vms", "list.0.needs_change", "false"),
+					resource.TestCheckResourceAttrSet("data.newvm_orders.vms", "list.0.billed_until"),
+					resource.TestCheckResourceAttr("data.newvm_orders.vms", "list.0.end_date", ""),
+					resource.TestCheckResourceAttr("data.newvm_orders.children", "list.#", "1"),
+					resource.TestCheckResourceAttrPair("data.newvm_orders.children", "list.0.id", "newvm_control_panel.plesk", "id"),
+					resource.TestCheckResourceAttr("data.newvm_orders.changing", "list.#", "0"),
+					resource.TestCheckResourceAttr("data.newvm_orders.billed_next_month", "list.#", "2"),
+					resource.TestCheckResourceAttr("data.newvm_orders.billed_today", "list.#", "0"),
+				),
+			},
+			{
+				Config: s.ProviderConfig() + `
+data "newvm_orders" "invalid" {
+  billed_until_from = "next month"
+}
+`,
+				ExpectError: regexp.MustCompile("Invalid Billing Date"),
+			},
+		},
+	})
+}
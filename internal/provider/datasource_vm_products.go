@@ -24,7 +24,7 @@ func NewVmProductsDataSource() datasource.DataSource {
 
 // vmProductsDataSource is the data source implementation.
 type vmProductsDataSource struct {
-	client *newvm.Client
+	client newvm.API
 }
 
 // vmProductsDataSourceModel maps the data source schema data.
@@ -95,7 +95,7 @@ func (d *vmProductsDataSource) Read(ctx context.Context, req datasource.ReadRequ
 		return
 	}
 
-	vmProducts, err := d.client.GetVmProducts()
+	vmProducts, err := d.client.GetVmProducts(ctx)
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Unable to read NewVM VM products",
@@ -137,11 +137,11 @@ func (d *vmProductsDataSource) Configure(_ context.Context, req datasource.Confi
 		return
 	}
 
-	client, ok := req.ProviderData.(*newvm.Client)
+	client, ok := req.ProviderData.(newvm.API)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *newvm.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected newvm.API, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
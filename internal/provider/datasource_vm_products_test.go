@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"testing"
+
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccVmProductsDataSource(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: s.ProviderConfig() + `
+data "newvm_vm_products" "all" {}
+
+data "newvm_vm_products" "a2" {
+  id = "VM-A2"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.newvm_vm_products.all", "list.#", "5"),
+					resource.TestCheckResourceAttr("data.newvm_vm_products.a2", "list.#", "1"),
+					resource.TestCheckResourceAttr("data.newvm_vm_products.a2", "list.0.product", "VM-A"),
+					resource.TestCheckResourceAttr("data.newvm_vm_products.a2", "list.0.ram", "2"),
+					resource.TestCheckResourceAttr("data.newvm_vm_products.a2", "list.0.cores", "2"),
+					resource.TestCheckResourceAttr("data.newvm_vm_products.a2", "list.0.hdsize", "40"),
+					resource.TestCheckResourceAttr("data.newvm_vm_products.a2", "list.0.price", "10"),
+				),
+			},
+		},
+	})
+}
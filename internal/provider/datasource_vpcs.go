@@ -24,7 +24,7 @@ func NewVpcsDataSource() datasource.DataSource {
 
 // vpcsDataSource is the data source implementation.
 type vpcsDataSource struct {
-	client *newvm.Client
+	client newvm.API
 }
 
 // vpcsDataSourceModel maps the data source schema data.
@@ -104,7 +104,7 @@ func (d *vpcsDataSource) Read(ctx context.Context, req datasource.ReadRequest, r
 		return
 	}
 
-	vpcs, err1 := d.client.GetVpcs()
+	vpcs, err1 := d.client.GetVpcs(ctx)
 	if err1 != nil {
 		resp.Diagnostics.AddError(
 			"Unable to read NewVM VPCs",
@@ -113,7 +113,7 @@ func (d *vpcsDataSource) Read(ctx context.Context, req datasource.ReadRequest, r
 		return
 	}
 
-	vpcMembers, err2 := d.client.GetVpcMembers()
+	vpcMembers, err2 := d.client.GetVpcMembers(ctx)
 	if err2 != nil {
 		resp.Diagnostics.AddError(
 			"Unable to read NewVM VPC members",
@@ -163,11 +163,11 @@ func (d *vpcsDataSource) Configure(_ context.Context, req datasource.ConfigureRe
 		return
 	}
 
-	client, ok := req.ProviderData.(*newvm.Client)
+	client, ok := req.ProviderData.(newvm.API)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *newvm.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected newvm.API, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
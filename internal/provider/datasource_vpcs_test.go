@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"testing"
+
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccVpcsDataSource(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: s.ProviderConfig() + `
+resource "newvm_vpc" "backend" {
+  name = "backend"
+}
+
+resource "newvm_vpc" "storage" {
+  name = "storage"
+}
+
+resource "newvm_vm" "web" {
+  product  = "VM-A1"
+  os       = "debian-12"
+  hostname = "web1.example.com"
+  vpc      = [newvm_vpc.backend.number]
+}
+
+data "newvm_vpcs" "all" {
+  depends_on = [newvm_vpc.storage, newvm_vm.web]
+}
+
+data "newvm_vpcs" "backend" {
+  number     = newvm_vpc.backend.number
+  depends_on = [newvm_vm.web]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.newvm_vpcs.all", "list.#", "2"),
+					resource.TestCheckResourceAttr("data.newvm_vpcs.backend", "list.#", "1"),
+					resource.TestCheckResourceAttr("data.newvm_vpcs.backend", "list.0.name", "backend"),
+					resource.TestCheckResourceAttr("data.newvm_vpcs.backend", "list.0.members.#", "1"),
+					resource.TestCheckResourceAttrPair("data.newvm_vpcs.backend", "list.0.members.0.orderid", "newvm_vm.web", "id"),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,128 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"unithost-terraform/internal/newvm"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// deletionPolicyAttribute is the deletion_policy attribute of the orderable
+// resources, allowing the given policies.
+func deletionPolicyAttribute(description string, policies ...newvm.DeletionPolicy) schema.StringAttribute {
+	return schema.StringAttribute{
+		Description: description,
+		Optional:    true,
+		Computed:    true,
+		Default:     stringdefault.StaticString(string(newvm.DeletionPolicyEndOfBillingPeriod)),
+		Validators: []validator.String{
+			deletionPolicyValidator{policies: policies},
+		},
+	}
+}
+
+// endDateAttribute is the computed end date of the order of a resource.
+func endDateAttribute() schema.StringAttribute {
+	return schema.StringAttribute{
+		Description: "Date (YYYY-MM-DD) the order ends on, empty while it runs. " +
+			"Destroying the resource reports the end date set by deletion_policy as a warning.",
+		Computed: true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.UseStateForUnknown(),
+		},
+	}
+}
+
+// deletionPolicyFromState returns the deletion policy of a resource, the
+// default for imported resources that do not have one yet.
+func deletionPolicyFromState(policy types.String) newvm.DeletionPolicy {
+	if policy.IsNull() || policy.IsUnknown() {
+		return newvm.DeletionPolicyEndOfBillingPeriod
+	}
+	return newvm.DeletionPolicy(policy.ValueString())
+}
+
+// addDeletionWarning reports when the order of a deleted resource ends, as
+// Terraform no longer shows the resource once it is destroyed.
+func addDeletionWarning(diags *diag.Diagnostics, resourceName, orderID, endDate string) {
+	if endDate == "" {
+		diags.AddWarning(
+			fmt.Sprintf("%s Stopped, Order Not Ended", resourceName),
+			fmt.Sprintf("Order %s was removed from Terraform but keeps running and being billed, as the deletion policy is stop_only. "+
+				"End it in the NewVM control panel when it is no longer needed.", orderID),
+		)
+		return
+	}
+	diags.AddWarning(
+		fmt.Sprintf("%s Order Ends on %s", resourceName, endDate),
+		fmt.Sprintf("Order %s was removed from Terraform and ends on %s. Until then it is still listed in the NewVM control panel.", orderID, endDate),
+	)
+}
+
+// addDeleteVmError reports a VM that could not be deleted. A VM with running
+// child orders lists them, as they are usually managed by other resources.
+func addDeleteVmError(diags *diag.Diagnostics, err error) {
+	var childErr *newvm.ChildOrdersError
+	if !errors.As(err, &childErr) {
+		diags.AddError("Error Deleting VM", "Could not delete VM, unexpected error: "+err.Error())
+		return
+	}
+
+	var childOrders strings.Builder
+	for _, childOrder := range childErr.ChildOrders {
+		fmt.Fprintf(&childOrders, "\n  - order %d (%s)", childOrder.ID, childOrder.ProductID)
+	}
+	diags.AddError(
+		"VM Has Running Child Orders",
+		fmt.Sprintf("Could not delete VM %d, these orders were placed under it and still run:%s\n\n", childErr.OrderID, childOrders.String())+
+			"Destroy the resources of these orders first, or set end_child_orders to true to end them together with the VM. "+
+			"The VM was left untouched.",
+	)
+}
+
+// deletionPolicyValidator validates that a string is one of the supported
+// deletion policies.
+type deletionPolicyValidator struct {
+	policies []newvm.DeletionPolicy
+}
+
+func (v deletionPolicyValidator) Description(_ context.Context) string {
+	return "value must be one of: " + v.names()
+}
+
+func (v deletionPolicyValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v deletionPolicyValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if !slices.Contains(v.policies, newvm.DeletionPolicy(req.ConfigValue.ValueString())) {
+		resp.Diagnostics.AddAttributeError(
+			req.Path,
+			"Invalid Deletion Policy",
+			fmt.Sprintf("Expected one of %s, got %q.", v.names(), req.ConfigValue.ValueString()),
+		)
+	}
+}
+
+func (v deletionPolicyValidator) names() string {
+	names := make([]string, len(v.policies))
+	for i, policy := range v.policies {
+		names[i] = string(policy)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,551 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"unithost-terraform/internal/newvm"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+// Ensure the fake satisfies the API interface.
+var _ newvm.API = &fakeAPI{}
+
+// fakeAPI is an in-memory newvm.API for unit testing resources and data
+// sources without HTTP. Orders get sequential IDs starting at 1000.
+type fakeAPI struct {
+	mu sync.Mutex
+
+	nextOrderID   int
+	vms           map[string]newvm.Vm
+	controlPanels map[int64]newvm.ControlPanel
+	vpcs          map[string]newvm.Vpc
+	orders        []newvm.NewVmOrder
+
+	locations            []newvm.Location
+	operatingSystems     []newvm.OperatingSystem
+	vmProducts           []newvm.VmProduct
+	controlPanelProducts []newvm.ControlPanelProduct
+
+	// orderErr is returned by the creates, to simulate rejected orders
+	orderErr error
+	// provisioningErr is returned by WaitForVm, to simulate failed provisioning
+	provisioningErr error
+	// changeErr is returned by the updates, to simulate failed change requests
+	changeErr error
+
+	// calls records the names of the API methods called, in order
+	calls []string
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{
+		nextOrderID:   1000,
+		vms:           map[string]newvm.Vm{},
+		controlPanels: map[int64]newvm.ControlPanel{},
+		vpcs:          map[string]newvm.Vpc{},
+	}
+}
+
+func (f *fakeAPI) record(call string) {
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeAPI) orderID() int {
+	f.nextOrderID++
+	return f.nextOrderID
+}
+
+func fakeNotFound(path string) error {
+	return &newvm.APIError{StatusCode: http.StatusNotFound, Message: "not found", Method: http.MethodGet, Path: path}
+}
+
+func (f *fakeAPI) GetControlPanelProducts(_ context.Context) ([]newvm.ControlPanelProduct, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetControlPanelProducts")
+	return slices.Clone(f.controlPanelProducts), nil
+}
+
+func (f *fakeAPI) GetLocations(_ context.Context) ([]newvm.Location, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetLocations")
+	return slices.Clone(f.locations), nil
+}
+
+func (f *fakeAPI) GetOperatingSystems(_ context.Context) ([]newvm.OperatingSystem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetOperatingSystems")
+	return slices.Clone(f.operatingSystems), nil
+}
+
+func (f *fakeAPI) GetVmProducts(_ context.Context) ([]newvm.VmProduct, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetVmProducts")
+	return slices.Clone(f.vmProducts), nil
+}
+
+func (f *fakeAPI) GetControlPanel(_ context.Context, orderID int64) (*newvm.ControlPanel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetControlPanel")
+	controlPanel, ok := f.controlPanels[orderID]
+	if !ok {
+		return nil, fakeNotFound(fmt.Sprintf("/account/v1/order/%d", orderID))
+	}
+	return &controlPanel, nil
+}
+
+func (f *fakeAPI) CreateControlPanel(_ context.Context, controlPanel newvm.ControlPanel) (*newvm.ControlPanel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("CreateControlPanel")
+	if f.orderErr != nil {
+		return nil, f.orderErr
+	}
+	controlPanel.ID = f.orderID()
+	f.controlPanels[int64(controlPanel.ID)] = controlPanel
+	return &controlPanel, nil
+}
+
+func (f *fakeAPI) UpdateControlPanel(_ context.Context, orderID int64, controlPanel newvm.ControlPanel) (*newvm.ControlPanel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("UpdateControlPanel")
+	if f.changeErr != nil {
+		return nil, f.changeErr
+	}
+	if _, ok := f.controlPanels[orderID]; !ok {
+		return nil, fakeNotFound(fmt.Sprintf("/account/v1/order/%d", orderID))
+	}
+	controlPanel.ID = int(orderID)
+	f.controlPanels[orderID] = controlPanel
+	return &controlPanel, nil
+}
+
+func (f *fakeAPI) DeleteControlPanel(_ context.Context, orderID int64, policy newvm.DeletionPolicy) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("DeleteControlPanel")
+	if _, ok := f.controlPanels[orderID]; !ok {
+		return "", fakeNotFound(fmt.Sprintf("/account/v1/order/%d", orderID))
+	}
+	delete(f.controlPanels, orderID)
+	return fakeEndDate(policy), nil
+}
+
+func (f *fakeAPI) GetAllOrders(_ context.Context) ([]newvm.NewVmOrder, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetAllOrders")
+	return slices.Clone(f.orders), nil
+}
+
+func (f *fakeAPI) GetOrder(_ context.Context, orderID string) (*newvm.NewVmOrder, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetOrder")
+	for _, order := range f.orders {
+		if strconv.Itoa(order.ID) == orderID {
+			return &order, nil
+		}
+	}
+	return nil, fakeNotFound("/account/v1/order/" + orderID)
+}
+
+func (f *fakeAPI) GetOrderByReference(_ context.Context, reference string) (*newvm.NewVmOrder, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetOrderByReference")
+	for _, vm := range f.vms {
+		if vm.Reference == reference && vm.EndDate == "" {
+			return &newvm.NewVmOrder{ID: vm.OrderID, ProductID: vm.VmProductID, Reference: vm.Reference}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeAPI) GetVm(_ context.Context, orderID string) (*newvm.Vm, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetVm")
+	vm, ok := f.vms[orderID]
+	if !ok {
+		return nil, fakeNotFound("/account/v1/order/" + orderID)
+	}
+	vm.Vpc = slices.Clone(vm.Vpc)
+	return &vm, nil
+}
+
+func (f *fakeAPI) CreateVm(_ context.Context, vm newvm.Vm) (*newvm.Vm, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("CreateVm")
+	if f.orderErr != nil {
+		return nil, f.orderErr
+	}
+	vm.OrderID = f.orderID()
+	vm.ID = fmt.Sprintf("00000000-0000-0000-0000-%012d", vm.OrderID)
+	f.vms[strconv.Itoa(vm.OrderID)] = vm
+	return &vm, nil
+}
+
+func (f *fakeAPI) UpdateVm(_ context.Context, orderID string, _ *newvm.Vm, vmNew newvm.Vm) (*newvm.Vm, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("UpdateVm")
+	if f.changeErr != nil {
+		return nil, f.changeErr
+	}
+	vm, ok := f.vms[orderID]
+	if !ok {
+		return nil, fakeNotFound("/account/v1/order/" + orderID)
+	}
+	vm.VmProductID = vmNew.VmProductID
+	vm.Ram = vmNew.Ram
+	vm.Cores = vmNew.Cores
+	vm.HdSize = vmNew.HdSize
+	vm.Vpc = slices.Clone(vmNew.Vpc)
+	f.vms[orderID] = vm
+	return &vm, nil
+}
+
+func (f *fakeAPI) DeleteVm(_ context.Context, orderID string, policy newvm.DeletionPolicy, _ bool) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("DeleteVm")
+	if _, ok := f.vms[orderID]; !ok {
+		return "", fakeNotFound("/account/v1/order/" + orderID)
+	}
+	delete(f.vms, orderID)
+	return fakeEndDate(policy), nil
+}
+
+// fakeEndDate is the end date the fake API sets for a deletion policy.
+func fakeEndDate(policy newvm.DeletionPolicy) string {
+	if policy == newvm.DeletionPolicyStopOnly {
+		return ""
+	}
+	return "2026-01-31"
+}
+
+func (f *fakeAPI) WaitForVm(_ context.Context, orderID string) (*newvm.Vm, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("WaitForVm")
+	if f.provisioningErr != nil {
+		return nil, f.provisioningErr
+	}
+	vm, ok := f.vms[orderID]
+	if !ok {
+		return nil, fakeNotFound("/account/v1/order/" + orderID)
+	}
+	vm.Vpc = slices.Clone(vm.Vpc)
+	return &vm, nil
+}
+
+func (f *fakeAPI) GetVpcs(_ context.Context) ([]newvm.Vpc, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetVpcs")
+	vpcs := []newvm.Vpc{}
+	for _, vpc := range f.vpcs {
+		vpcs = append(vpcs, vpc)
+	}
+	slices.SortFunc(vpcs, func(a, b newvm.Vpc) int { return int(a.Number - b.Number) })
+	return vpcs, nil
+}
+
+func (f *fakeAPI) GetVpcMembers(_ context.Context) ([]newvm.VpcMember, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetVpcMembers")
+	members := []newvm.VpcMember{}
+	for _, vm := range f.vms {
+		for _, number := range vm.Vpc {
+			members = append(members, newvm.VpcMember{Vxlan: number, OrderID: vm.OrderID})
+		}
+	}
+	return members, nil
+}
+
+func (f *fakeAPI) GetVpc(_ context.Context, ID string) (*newvm.Vpc, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetVpc")
+	vpc, ok := f.vpcs[ID]
+	if !ok {
+		return nil, fakeNotFound("/backend/com.newvm.network/v1/vxlan/" + ID)
+	}
+	return &vpc, nil
+}
+
+func (f *fakeAPI) CreateVpc(_ context.Context, vpc newvm.Vpc) (*newvm.Vpc, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("CreateVpc")
+	number := int32(100 + len(f.vpcs))
+	vpc.ID = fmt.Sprintf("vxlan-%d", number)
+	vpc.Number = number
+	vpc.Removable = 1
+	f.vpcs[vpc.ID] = vpc
+	return &vpc, nil
+}
+
+func (f *fakeAPI) UpdateVpc(_ context.Context, ID string, vpc newvm.Vpc) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("UpdateVpc")
+	existing, ok := f.vpcs[ID]
+	if !ok {
+		return fakeNotFound("/backend/com.newvm.network/v1/vxlan/" + ID)
+	}
+	existing.Name = vpc.Name
+	f.vpcs[ID] = existing
+	return nil
+}
+
+func (f *fakeAPI) DeleteVpc(_ context.Context, ID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("DeleteVpc")
+	if _, ok := f.vpcs[ID]; !ok {
+		return fakeNotFound("/backend/com.newvm.network/v1/vxlan/" + ID)
+	}
+	delete(f.vpcs, ID)
+	return nil
+}
+
+// resourceSchema returns the schema of r, failing the test if it is invalid.
+func resourceSchema(t *testing.T, r resource.Resource) schema.Schema {
+	t.Helper()
+
+	var resp resource.SchemaResponse
+	r.Schema(context.Background(), resource.SchemaRequest{}, &resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("invalid schema: %v", resp.Diagnostics.Errors())
+	}
+	return resp.Schema
+}
+
+// withNullTimeouts returns a copy of model with an unset Timeouts field
+// replaced by a null value of the timeouts block type of s, as the zero
+// value lacks the attribute types.
+func withNullTimeouts(t *testing.T, s schema.Schema, model any) any {
+	t.Helper()
+
+	ctx := context.Background()
+	value := reflect.ValueOf(model)
+	if value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+	field := value.FieldByName("Timeouts")
+	if !field.IsValid() || !field.IsZero() {
+		return model
+	}
+
+	typ, diags := s.TypeAtPath(ctx, path.Root("timeouts"))
+	if diags.HasError() {
+		t.Fatalf("no timeouts block: %v", diags.Errors())
+	}
+	null, err := typ.ValueFromTerraform(ctx, tftypes.NewValue(typ.TerraformType(ctx), nil))
+	if err != nil {
+		t.Fatalf("unable to create null timeouts: %v", err)
+	}
+
+	copied := reflect.New(value.Type()).Elem()
+	copied.Set(value)
+	copied.FieldByName("Timeouts").Set(reflect.ValueOf(null))
+	return copied.Interface()
+}
+
+// newTestPlan returns a plan for r populated from model.
+func newTestPlan(t *testing.T, r resource.Resource, model any) tfsdk.Plan {
+	t.Helper()
+
+	ctx := context.Background()
+	s := resourceSchema(t, r)
+	plan := tfsdk.Plan{Schema: s, Raw: tftypes.NewValue(s.Type().TerraformType(ctx), nil)}
+	if diags := plan.Set(ctx, withNullTimeouts(t, s, model)); diags.HasError() {
+		t.Fatalf("unable to set plan: %v", diags.Errors())
+	}
+	return plan
+}
+
+// newTestState returns a state for r populated from model, or an empty
+// state when model is nil.
+func newTestState(t *testing.T, r resource.Resource, model any) tfsdk.State {
+	t.Helper()
+
+	ctx := context.Background()
+	s := resourceSchema(t, r)
+	state := tfsdk.State{Schema: s, Raw: tftypes.NewValue(s.Type().TerraformType(ctx), nil)}
+	if model != nil {
+		if diags := state.Set(ctx, withNullTimeouts(t, s, model)); diags.HasError() {
+			t.Fatalf("unable to set state: %v", diags.Errors())
+		}
+	}
+	return state
+}
+
+// placeholders are expected values of attributes that differ between runs,
+// with the check the actual value has to pass instead.
+var placeholders = map[string]func(string) bool{
+	"(now)": func(value string) bool {
+		_, err := time.Parse(time.RFC850, value)
+		return err == nil
+	},
+	"(reference)": regexp.MustCompile(`^tf-[0-9a-f]{16}$`).MatchString,
+}
+
+// resourceTest is a call of a CRUD method of a resource against the fake
+// API, with the API calls and the state it is expected to result in.
+type resourceTest struct {
+	name string
+	// setup prepares the fake API before its calls are recorded
+	setup func(api *fakeAPI)
+	// method is Create, Read, Update or Delete
+	method string
+	// state and plan are the models of the prior state and the plan, nil
+	// when the method has none
+	state, plan any
+	calls       []string
+	// errors holds the attribute paths of the expected errors, "" for an
+	// error without attribute
+	errors []string
+	// expected is the model of the resulting state, nil when the resource
+	// is removed from it. last_updated and client_reference may hold a
+	// placeholder.
+	expected any
+	// check makes further assertions on what was sent to the API
+	check func(t *testing.T, api *fakeAPI)
+}
+
+// runResourceTests runs each test against the resource newResource returns
+// for a new fake API.
+func runResourceTests(t *testing.T, newResource func(api *fakeAPI) resource.Resource, tests []resourceTest) {
+	t.Helper()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			api := newFakeAPI()
+			if test.setup != nil {
+				test.setup(api)
+			}
+			api.calls = nil
+			r := newResource(api)
+
+			state, diags := callResource(t, r, test.method, test.state, test.plan)
+			if !slices.Equal(api.calls, test.calls) {
+				t.Errorf("expected the API calls %v, got %v", test.calls, api.calls)
+			}
+			if paths := errorPaths(diags); !slices.Equal(paths, test.errors) {
+				t.Errorf("expected errors on %q, got %v", test.errors, diags.Errors())
+			}
+			if test.check != nil {
+				test.check(t, api)
+			}
+
+			if test.expected == nil {
+				if !state.Raw.IsNull() {
+					t.Fatalf("expected the resource to be removed from state, got %s", state.Raw)
+				}
+				return
+			}
+			if state.Raw.IsNull() {
+				t.Fatal("expected a state, the resource was removed from it")
+			}
+			expected := newTestState(t, r, test.expected)
+			for _, name := range []string{"last_updated", "client_reference"} {
+				var placeholder, value types.String
+				if expected.GetAttribute(ctx, path.Root(name), &placeholder).HasError() {
+					continue
+				}
+				check, ok := placeholders[placeholder.ValueString()]
+				if !ok {
+					continue
+				}
+				state.GetAttribute(ctx, path.Root(name), &value)
+				if !check(value.ValueString()) {
+					t.Errorf("expected %s to be %s, got %s", name, placeholder, value)
+				}
+				state.SetAttribute(ctx, path.Root(name), placeholder)
+			}
+			diffs, err := state.Raw.Diff(expected.Raw)
+			if err != nil {
+				t.Fatalf("unable to compare states: %v", err)
+			}
+			var reported []*tftypes.AttributePath
+			for _, diff := range diffs {
+				// report the attributes that differ, not the objects holding
+				// them or the elements of a collection already reported
+				if diff.Value1 != nil && diff.Value2 != nil && diff.Value1.Type().Is(tftypes.Object{}) {
+					continue
+				}
+				if slices.ContainsFunc(reported, diff.Path.WithoutLastStep().Equal) {
+					continue
+				}
+				reported = append(reported, diff.Path)
+				t.Errorf("unexpected %s: got %s, expected %s", diff.Path, diff.Value1, diff.Value2)
+			}
+		})
+	}
+}
+
+// callResource calls method of r with a state and a plan from the models
+// prior and planned, and returns the resulting state. Like Terraform, it
+// removes the resource from state after a successful Delete.
+func callResource(t *testing.T, r resource.Resource, method string, prior, planned any) (tfsdk.State, diag.Diagnostics) {
+	t.Helper()
+
+	ctx := context.Background()
+	state := newTestState(t, r, prior)
+	var plan tfsdk.Plan
+	if planned != nil {
+		plan = newTestPlan(t, r, planned)
+	}
+
+	switch method {
+	case "Create":
+		resp := resource.CreateResponse{State: state}
+		r.Create(ctx, resource.CreateRequest{Plan: plan}, &resp)
+		return resp.State, resp.Diagnostics
+	case "Read":
+		resp := resource.ReadResponse{State: state}
+		r.Read(ctx, resource.ReadRequest{State: state}, &resp)
+		return resp.State, resp.Diagnostics
+	case "Update":
+		resp := resource.UpdateResponse{State: state}
+		r.Update(ctx, resource.UpdateRequest{Plan: plan, State: state}, &resp)
+		return resp.State, resp.Diagnostics
+	case "Delete":
+		resp := resource.DeleteResponse{State: state}
+		r.Delete(ctx, resource.DeleteRequest{State: state}, &resp)
+		if !resp.Diagnostics.HasError() {
+			resp.State.RemoveResource(ctx)
+		}
+		return resp.State, resp.Diagnostics
+	}
+
+	t.Fatalf("unknown resource method %s", method)
+	return tfsdk.State{}, nil
+}
@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"context"
+
+	"unithost-terraform/internal/newvm"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// promoCodesAttribute is the promo_codes attribute of the orderable resources.
+func promoCodesAttribute() schema.SetAttribute {
+	return schema.SetAttribute{
+		Description: "Promo codes applied when the order is placed. Changing them later does not change the existing order.",
+		Optional:    true,
+		ElementType: types.StringType,
+	}
+}
+
+// promoCodesFromPlan returns the configured promo codes, nil when there are none.
+func promoCodesFromPlan(ctx context.Context, promoCodes types.Set, diags *diag.Diagnostics) []string {
+	if promoCodes.IsNull() || promoCodes.IsUnknown() {
+		return nil
+	}
+	var codes []string
+	diags.Append(promoCodes.ElementsAs(ctx, &codes, false)...)
+	return codes
+}
+
+// addCreateError reports a failed order. An order with promo codes that NewVM
+// rejected because of them is reported on the promo_codes attribute.
+func addCreateError(diags *diag.Diagnostics, summary, detail string, promoCodes []string, err error) {
+	if len(promoCodes) > 0 && newvm.IsPromoCodeRejection(err) {
+		diags.AddAttributeError(path.Root("promo_codes"), "Invalid Promo Code", "NewVM rejected the order: "+err.Error())
+		return
+	}
+	diags.AddError(summary, detail+err.Error())
+}
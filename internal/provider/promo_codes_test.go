@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"unithost-terraform/internal/newvm"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestCreateReportsRejectedPromoCode(t *testing.T) {
+	ctx := context.Background()
+	promoCodes := types.SetValueMust(types.StringType, []attr.Value{types.StringValue("NOSUCHCODE")})
+	rejected := &newvm.APIError{
+		StatusCode: http.StatusBadRequest,
+		Message:    `promo code "NOSUCHCODE" is not valid`,
+		Method:     http.MethodPost,
+		Path:       "/account/v1/customer/self/order/VM",
+	}
+	unavailable := &newvm.APIError{
+		StatusCode: http.StatusServiceUnavailable,
+		Message:    "promotions are temporarily unavailable",
+		Method:     http.MethodPost,
+		Path:       "/account/v1/customer/self/order/VM",
+	}
+
+	create := map[string]func(api *fakeAPI, promoCodes types.Set) diag.Diagnostics{
+		"vm": func(api *fakeAPI, promoCodes types.Set) diag.Diagnostics {
+			r := &vmResource{client: api}
+			plan := newTestVmModel()
+			plan.PromoCodes = promoCodes
+			resp := resource.CreateResponse{State: newTestState(t, r, nil)}
+			r.Create(ctx, resource.CreateRequest{Plan: newTestPlan(t, r, plan)}, &resp)
+			return resp.Diagnostics
+		},
+		"control panel": func(api *fakeAPI, promoCodes types.Set) diag.Diagnostics {
+			r := &controlPanelResource{client: api}
+			plan := controlPanelResourceModel{
+				ID:          types.Int64Unknown(),
+				ProductID:   types.StringValue("CP_PLESK.plesk_12_license.1"),
+				VmID:        types.Int64Value(1001),
+				PromoCodes:  promoCodes,
+				LastUpdated: types.StringUnknown(),
+			}
+			resp := resource.CreateResponse{State: newTestState(t, r, nil)}
+			r.Create(ctx, resource.CreateRequest{Plan: newTestPlan(t, r, plan)}, &resp)
+			return resp.Diagnostics
+		},
+	}
+
+	tests := []struct {
+		name       string
+		promoCodes types.Set
+		err        error
+		expected   path.Path // empty for a diagnostic without attribute
+	}{
+		{name: "rejected promo code", promoCodes: promoCodes, err: rejected, expected: path.Root("promo_codes")},
+		{name: "server error", promoCodes: promoCodes, err: unavailable},
+		{name: "no promo codes", promoCodes: types.SetNull(types.StringType), err: rejected},
+	}
+
+	for resourceName, create := range create {
+		for _, test := range tests {
+			t.Run(resourceName+"/"+test.name, func(t *testing.T) {
+				api := newFakeAPI()
+				api.orderErr = test.err
+
+				diags := create(api, test.promoCodes)
+				if diags.ErrorsCount() != 1 {
+					t.Fatalf("expected one error, got %v", diags.Errors())
+				}
+				var attributePath path.Path
+				if withPath, ok := diags.Errors()[0].(diag.DiagnosticWithPath); ok {
+					attributePath = withPath.Path()
+				}
+				if !attributePath.Equal(test.expected) {
+					t.Fatalf("expected the error on %q, got it on %q: %v", test.expected, attributePath, diags.Errors())
+				}
+			})
+		}
+	}
+}
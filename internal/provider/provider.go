@@ -2,12 +2,16 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"os"
+	"time"
 	"unithost-terraform/internal/newvm"
 
 	// "unithost-terraform/internal/provider"
 
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
@@ -30,12 +34,44 @@ func New(version string) func() provider.Provider {
 	}
 }
 
+// Defaults for the client-side rate limiting of NewVM API requests.
+const (
+	defaultMaxRequestsPerSecond  = 10
+	defaultMaxConcurrentRequests = 8
+)
+
 // newvmProviderModel maps provider schema data to a Go type.
 type newvmProviderModel struct {
-	Host     types.String `tfsdk:"host"`
-	Username types.String `tfsdk:"username"`
-	Password types.String `tfsdk:"password"`
-	Totp     types.String `tfsdk:"totp"`
+	Host       types.String     `tfsdk:"host"`
+	Username   types.String     `tfsdk:"username"`
+	Password   types.String     `tfsdk:"password"`
+	Totp       types.String     `tfsdk:"totp"`
+	Token      types.String     `tfsdk:"token"`
+	TotpSecret types.String     `tfsdk:"totp_secret"`
+	Retry      *newvmRetryModel `tfsdk:"retry"`
+
+	MaxRequestsPerSecond  types.Float64 `tfsdk:"max_requests_per_second"`
+	MaxConcurrentRequests types.Int64   `tfsdk:"max_concurrent_requests"`
+
+	RequestTimeout     types.String `tfsdk:"request_timeout"`
+	ProxyURL           types.String `tfsdk:"proxy_url"`
+	CACertFile         types.String `tfsdk:"ca_cert_file"`
+	ClientCertFile     types.String `tfsdk:"client_cert_file"`
+	ClientKeyFile      types.String `tfsdk:"client_key_file"`
+	InsecureSkipVerify types.Bool   `tfsdk:"insecure_skip_verify"`
+
+	CatalogCacheTTL types.String `tfsdk:"catalog_cache_ttl"`
+	PollInterval    types.String `tfsdk:"poll_interval"`
+	BillingTimezone types.String `tfsdk:"billing_timezone"`
+	TokenCache      types.Bool   `tfsdk:"token_cache"`
+	TokenCacheDir   types.String `tfsdk:"token_cache_dir"`
+}
+
+// newvmRetryModel maps the retry block of the provider schema.
+type newvmRetryModel struct {
+	MaxAttempts types.Int64  `tfsdk:"max_attempts"`
+	MinBackoff  types.String `tfsdk:"min_backoff"`
+	MaxBackoff  types.String `tfsdk:"max_backoff"`
 }
 
 // newvmProvider is the provider implementation.
@@ -74,6 +110,95 @@ func (p *newvmProvider) Schema(_ context.Context, _ provider.SchemaRequest, resp
 				Description: "TOTP token for NewVM API.",
 				Optional:    true,
 			},
+			"totp_secret": schema.StringAttribute{
+				Description: "Base32 encoded TOTP secret for NewVM API, used to generate the TOTP code for every login instead of a fixed totp value. " +
+					"May also be provided via NEWVM_TOTP_SECRET environment variable.",
+				Optional:  true,
+				Sensitive: true,
+			},
+			"token": schema.StringAttribute{
+				Description: "Long-lived API token for NewVM API, used instead of username, password and TOTP. " +
+					"May also be provided via NEWVM_TOKEN environment variable.",
+				Optional:  true,
+				Sensitive: true,
+			},
+			"max_requests_per_second": schema.Float64Attribute{
+				Description: "Maximum average number of NewVM API requests per second, shared by all resources and data sources. " +
+					"Defaults to 10, use 0 to disable the limit.",
+				Optional: true,
+			},
+			"max_concurrent_requests": schema.Int64Attribute{
+				Description: "Maximum number of NewVM API requests in flight at the same time, shared by all resources and data sources. " +
+					"Defaults to 8, use 0 to disable the limit.",
+				Optional: true,
+			},
+			"request_timeout": schema.StringAttribute{
+				Description: "Time limit for a single NewVM API request as a duration (eg. '2m'). Defaults to '60s'.",
+				Optional:    true,
+			},
+			"proxy_url": schema.StringAttribute{
+				Description: "URL of the HTTP proxy for NewVM API requests. Defaults to the HTTPS_PROXY and NO_PROXY environment variables.",
+				Optional:    true,
+			},
+			"ca_cert_file": schema.StringAttribute{
+				Description: "Path to a PEM bundle of CA certificates to trust in addition to the system roots, eg. for a TLS-inspecting proxy.",
+				Optional:    true,
+			},
+			"client_cert_file": schema.StringAttribute{
+				Description: "Path to a PEM client certificate for mutual TLS. Requires client_key_file.",
+				Optional:    true,
+			},
+			"client_key_file": schema.StringAttribute{
+				Description: "Path to the PEM private key of client_cert_file.",
+				Optional:    true,
+			},
+			"insecure_skip_verify": schema.BoolAttribute{
+				Description: "Skip verification of the NewVM API server certificate. Only use this for testing.",
+				Optional:    true,
+			},
+			"catalog_cache_ttl": schema.StringAttribute{
+				Description: "How long the operating system, location and VPC lists are reused between resources as a duration (eg. '10m'). " +
+					"Defaults to '5m', use '0s' to disable the cache. Changes to VPCs made by the provider always invalidate the VPC list.",
+				Optional: true,
+			},
+			"poll_interval": schema.StringAttribute{
+				Description: "Wait between two checks of an order while waiting for it to be provisioned, as a duration above zero (eg. '10s'). Defaults to '10s'.",
+				Optional:    true,
+			},
+			"billing_timezone": schema.StringAttribute{
+				Description: "IANA timezone the billing periods of orders end in (eg. 'Europe/Amsterdam'), used to calculate the end date of destroyed VMs and control panels. " +
+					"Defaults to 'Europe/Amsterdam'.",
+				Optional: true,
+			},
+			"token_cache": schema.BoolAttribute{
+				Description: "Store the session token on disk and reuse it in later runs while it is valid, instead of logging in (and entering a TOTP code) for every run. " +
+					"Only used with username and password authentication. Defaults to false.",
+				Optional: true,
+			},
+			"token_cache_dir": schema.StringAttribute{
+				Description: "Directory for the token cache, only readable by the current user. Defaults to 'terraform-provider-newvm' in the user cache directory.",
+				Optional:    true,
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"retry": schema.SingleNestedBlock{
+				Description: "Retry policy for transient NewVM API failures (429, 502, 503, 504 and connection errors). " +
+					"Only idempotent requests are retried, apart from requests the API rejected before processing them.",
+				Attributes: map[string]schema.Attribute{
+					"max_attempts": schema.Int64Attribute{
+						Description: "Total number of attempts per request, including the first one. Defaults to 4, use 1 to disable retries.",
+						Optional:    true,
+					},
+					"min_backoff": schema.StringAttribute{
+						Description: "Wait before the first retry as a duration (eg. '1s'), at most max_backoff. Doubles for every next retry. Defaults to '1s'.",
+						Optional:    true,
+					},
+					"max_backoff": schema.StringAttribute{
+						Description: "Upper bound for the wait between retries as a duration (eg. '30s'). Defaults to '30s'.",
+						Optional:    true,
+					},
+				},
+			},
 		},
 	}
 }
@@ -120,6 +245,24 @@ func (p *newvmProvider) Configure(ctx context.Context, req provider.ConfigureReq
 		)
 	}
 
+	if config.TotpSecret.IsUnknown() {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("totp_secret"),
+			"Unknown NewVM API TOTP Secret",
+			"The provider cannot create the NewVM API client as there is an unknown configuration value for the NewVM API TOTP secret. "+
+				"Either target apply the source of the value first, set the value statically in the configuration, or use the NEWVM_TOTP_SECRET environment variable.",
+		)
+	}
+
+	if config.Token.IsUnknown() {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("token"),
+			"Unknown NewVM API Token",
+			"The provider cannot create the NewVM API client as there is an unknown configuration value for the NewVM API token. "+
+				"Either target apply the source of the value first, set the value statically in the configuration, or use the NEWVM_TOKEN environment variable.",
+		)
+	}
+
 	if resp.Diagnostics.HasError() {
 		return
 	}
@@ -131,6 +274,8 @@ func (p *newvmProvider) Configure(ctx context.Context, req provider.ConfigureReq
 	username := os.Getenv("NEWVM_USERNAME")
 	password := os.Getenv("NEWVM_PASSWORD")
 	totp := ""
+	totpSecret := os.Getenv("NEWVM_TOTP_SECRET")
+	token := os.Getenv("NEWVM_TOKEN")
 
 	if !config.Host.IsNull() {
 		host = config.Host.ValueString()
@@ -148,6 +293,14 @@ func (p *newvmProvider) Configure(ctx context.Context, req provider.ConfigureReq
 		totp = config.Totp.ValueString()
 	}
 
+	if !config.TotpSecret.IsNull() {
+		totpSecret = config.TotpSecret.ValueString()
+	}
+
+	if !config.Token.IsNull() {
+		token = config.Token.ValueString()
+	}
+
 	// If any of the expected configurations are missing, return
 	// errors with provider-specific guidance.
 
@@ -161,23 +314,160 @@ func (p *newvmProvider) Configure(ctx context.Context, req provider.ConfigureReq
 		)
 	}
 
-	if username == "" {
+	// Exactly one authentication method must be configured: either an API
+	// token, or username and password (with an optional TOTP code).
+	if token != "" {
+		if username != "" || password != "" || totp != "" || totpSecret != "" {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("token"),
+				"Conflicting NewVM API Authentication",
+				"The provider cannot create the NewVM API client as both an API token and username/password credentials are configured. "+
+					"Either use the token value (or the NEWVM_TOKEN environment variable), or use username, password and totp or totp_secret, but not both. "+
+					"Check the NEWVM_USERNAME, NEWVM_PASSWORD and NEWVM_TOTP_SECRET environment variables if they are not set in the configuration.",
+			)
+		}
+	} else {
+		if username == "" {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("username"),
+				"Missing NewVM API Username",
+				"The provider cannot create the NewVM API client as there is a missing or empty value for the NewVM API username. "+
+					"Set the username value in the configuration or use the NEWVM_USERNAME environment variable, or authenticate with an API token instead. "+
+					"If either is already set, ensure the value is not empty.",
+			)
+		}
+
+		if password == "" {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("password"),
+				"Missing NewVM API Password",
+				"The provider cannot create the NewVM API client as there is a missing or empty value for the NewVM API password. "+
+					"Set the password value in the configuration or use the NEWVM_PASSWORD environment variable, or authenticate with an API token instead. "+
+					"If either is already set, ensure the value is not empty.",
+			)
+		}
+
+		if totp != "" && totpSecret != "" {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("totp_secret"),
+				"Conflicting NewVM API TOTP Configuration",
+				"The provider cannot create the NewVM API client as both a TOTP code and a TOTP secret are configured. "+
+					"Use totp_secret (or the NEWVM_TOTP_SECRET environment variable) to generate codes automatically, or totp for a single code, but not both.",
+			)
+		} else if totpSecret != "" {
+			if _, err := newvm.GenerateTotp(totpSecret, time.Now()); err != nil {
+				resp.Diagnostics.AddAttributeError(
+					path.Root("totp_secret"),
+					"Invalid NewVM API TOTP Secret",
+					"The provider cannot create the NewVM API client as the TOTP secret is invalid: "+err.Error(),
+				)
+			}
+		}
+	}
+
+	retryPolicy := newvm.DefaultRetryPolicy
+	if config.Retry != nil {
+		if !config.Retry.MaxAttempts.IsNull() {
+			retryPolicy.MaxAttempts = int(config.Retry.MaxAttempts.ValueInt64())
+			if retryPolicy.MaxAttempts < 1 {
+				resp.Diagnostics.AddAttributeError(
+					path.Root("retry").AtName("max_attempts"),
+					"Invalid NewVM API Retry Attempts",
+					"The retry max_attempts value must be at least 1.",
+				)
+			}
+		}
+		var backoffDiags diag.Diagnostics
+		if !config.Retry.MinBackoff.IsNull() {
+			retryPolicy.MinBackoff = parseDurationAttribute(config.Retry.MinBackoff, path.Root("retry").AtName("min_backoff"), &backoffDiags)
+		}
+		if !config.Retry.MaxBackoff.IsNull() {
+			retryPolicy.MaxBackoff = parseDurationAttribute(config.Retry.MaxBackoff, path.Root("retry").AtName("max_backoff"), &backoffDiags)
+		}
+		resp.Diagnostics.Append(backoffDiags...)
+		if !backoffDiags.HasError() && retryPolicy.MinBackoff > retryPolicy.MaxBackoff {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("retry").AtName("min_backoff"),
+				"Invalid NewVM API Retry Backoff",
+				fmt.Sprintf("The retry min_backoff value %s must not exceed the max_backoff value %s.", retryPolicy.MinBackoff, retryPolicy.MaxBackoff),
+			)
+		}
+	}
+
+	maxRequestsPerSecond := float64(defaultMaxRequestsPerSecond)
+	if !config.MaxRequestsPerSecond.IsNull() {
+		maxRequestsPerSecond = config.MaxRequestsPerSecond.ValueFloat64()
+		if maxRequestsPerSecond < 0 {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("max_requests_per_second"),
+				"Invalid NewVM API Rate Limit",
+				"The max_requests_per_second value must not be negative, use 0 to disable the limit.",
+			)
+		}
+	}
+
+	maxConcurrentRequests := defaultMaxConcurrentRequests
+	if !config.MaxConcurrentRequests.IsNull() {
+		maxConcurrentRequests = int(config.MaxConcurrentRequests.ValueInt64())
+		if maxConcurrentRequests < 0 {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("max_concurrent_requests"),
+				"Invalid NewVM API Concurrency Limit",
+				"The max_concurrent_requests value must not be negative, use 0 to disable the limit.",
+			)
+		}
+	}
+
+	transportConfig := newvm.TransportConfig{
+		ProxyURL:           config.ProxyURL.ValueString(),
+		CACertFile:         config.CACertFile.ValueString(),
+		ClientCertFile:     config.ClientCertFile.ValueString(),
+		ClientKeyFile:      config.ClientKeyFile.ValueString(),
+		InsecureSkipVerify: config.InsecureSkipVerify.ValueBool(),
+	}
+	if !config.RequestTimeout.IsNull() {
+		transportConfig.Timeout = parseDurationAttribute(config.RequestTimeout, path.Root("request_timeout"), &resp.Diagnostics)
+	}
+	catalogTTL := newvm.DefaultCatalogTTL
+	if !config.CatalogCacheTTL.IsNull() {
+		catalogTTL = parseDurationAttribute(config.CatalogCacheTTL, path.Root("catalog_cache_ttl"), &resp.Diagnostics)
+	}
+	pollInterval := newvm.DefaultPollInterval
+	if !config.PollInterval.IsNull() {
+		pollInterval = parsePositiveDurationAttribute(config.PollInterval, path.Root("poll_interval"), &resp.Diagnostics)
+	}
+	billingTimezoneName := newvm.DefaultBillingTimezone
+	if !config.BillingTimezone.IsNull() {
+		billingTimezoneName = config.BillingTimezone.ValueString()
+	}
+	// "" and "Local" are accepted by LoadLocation, but are not billing timezones
+	billingTimezone, err := time.LoadLocation(billingTimezoneName)
+	if err != nil || billingTimezoneName == "" || billingTimezoneName == "Local" {
 		resp.Diagnostics.AddAttributeError(
-			path.Root("username"),
-			"Missing NewVM API Username",
-			"The provider cannot create the NewVM API client as there is a missing or empty value for the NewVM API username. "+
-				"Set the username value in the configuration or use the NEWVM_USERNAME environment variable. "+
-				"If either is already set, ensure the value is not empty.",
+			path.Root("billing_timezone"),
+			"Invalid NewVM Billing Timezone",
+			fmt.Sprintf("Expected an IANA timezone like Europe/Amsterdam or UTC, got %q.", billingTimezoneName),
 		)
 	}
 
-	if password == "" {
+	var tokenCache *newvm.TokenCache
+	if config.TokenCache.ValueBool() && token == "" {
+		var err error
+		tokenCache, err = newvm.NewTokenCache(config.TokenCacheDir.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("token_cache_dir"),
+				"Unable to Use NewVM Token Cache",
+				"The provider cannot use the token cache: "+err.Error()+". Set token_cache_dir to a directory for the token cache.",
+			)
+		}
+	}
+
+	if (transportConfig.ClientCertFile == "") != (transportConfig.ClientKeyFile == "") {
 		resp.Diagnostics.AddAttributeError(
-			path.Root("password"),
-			"Missing NewVM API Password",
-			"The provider cannot create the NewVM API client as there is a missing or empty value for the NewVM API password. "+
-				"Set the password value in the configuration or use the NEWVM_PASSWORD environment variable. "+
-				"If either is already set, ensure the value is not empty.",
+			path.Root("client_cert_file"),
+			"Incomplete NewVM API Client Certificate",
+			"Both client_cert_file and client_key_file must be set to use a client certificate.",
 		)
 	}
 
@@ -185,15 +475,33 @@ func (p *newvmProvider) Configure(ctx context.Context, req provider.ConfigureReq
 		return
 	}
 
+	httpClient, err := newvm.NewHTTPClient(transportConfig)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to Configure NewVM API Transport",
+			"The provider cannot create the NewVM API client as the HTTP transport settings are invalid: "+err.Error(),
+		)
+		return
+	}
+
 	ctx = tflog.SetField(ctx, "newvm_host", host)
 	ctx = tflog.SetField(ctx, "newvm_username", username)
-	ctx = tflog.SetField(ctx, "newvm_password", password)
-	ctx = tflog.MaskFieldValuesWithFieldKeys(ctx, "newvm_password")
 
 	tflog.Debug(ctx, "Creating NewVM client")
 
 	// Create a new NewVM client using the configuration values
-	client, err := newvm.NewClient(&host, &username, &password, &totp)
+	client, err := newvm.NewClient(ctx, &host, &username, &password, &totp,
+		newvm.WithHTTPClient(httpClient),
+		newvm.WithRetryPolicy(retryPolicy),
+		newvm.WithToken(token),
+		newvm.WithTotpSecret(totpSecret),
+		newvm.WithRateLimit(maxRequestsPerSecond, int(math.Ceil(maxRequestsPerSecond))),
+		newvm.WithMaxConcurrency(maxConcurrentRequests),
+		newvm.WithCatalogTTL(catalogTTL),
+		newvm.WithPollInterval(pollInterval),
+		newvm.WithBillingTimezone(billingTimezone),
+		newvm.WithTokenCache(tokenCache),
+	)
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Unable to Create NewVM API Client",
@@ -209,7 +517,36 @@ func (p *newvmProvider) Configure(ctx context.Context, req provider.ConfigureReq
 	resp.DataSourceData = client
 	resp.ResourceData = client
 
-	tflog.Info(ctx, "Configured NewVM client with token: "+client.Token, map[string]any{"success": true})
+	tflog.Info(ctx, "Configured NewVM client", map[string]any{"success": true})
+}
+
+// parseDurationAttribute parses a duration string attribute such as "30s",
+// adding an attribute error to diags when the value is invalid.
+func parseDurationAttribute(value types.String, attrPath path.Path, diags *diag.Diagnostics) time.Duration {
+	duration, err := time.ParseDuration(value.ValueString())
+	if err != nil || duration < 0 {
+		diags.AddAttributeError(
+			attrPath,
+			"Invalid Duration",
+			fmt.Sprintf("The value %q is not a valid duration. Use a positive duration such as '30s' or '5m'.", value.ValueString()),
+		)
+		return 0
+	}
+	return duration
+}
+
+// parsePositiveDurationAttribute parses a duration string attribute like
+// parseDurationAttribute, but also rejects a zero duration.
+func parsePositiveDurationAttribute(value types.String, attrPath path.Path, diags *diag.Diagnostics) time.Duration {
+	if duration, err := time.ParseDuration(value.ValueString()); err == nil && duration == 0 {
+		diags.AddAttributeError(
+			attrPath,
+			"Invalid Duration",
+			fmt.Sprintf("The value %q is not a valid duration. Use a duration above zero such as '10s'.", value.ValueString()),
+		)
+		return 0
+	}
+	return parseDurationAttribute(value, attrPath, diags)
 }
 
 // DataSources defines the data sources implemented in the provider.
@@ -218,6 +555,7 @@ func (p *newvmProvider) DataSources(_ context.Context) []func() datasource.DataS
 		NewControlPanelProductsDataSource,
 		NewLocationsDataSource,
 		NewOperatingSystemsDataSource,
+		NewOrdersDataSource,
 		NewVmProductsDataSource,
 		NewVpcsDataSource,
 	}
@@ -4,26 +4,26 @@
 package provider
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"testing"
 
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
 	"github.com/hashicorp/terraform-plugin-testing/echoprovider"
-)
-
-const (
-	// providerConfig is a shared configuration to combine with the actual
-	// test configuration so the HashiCups client is properly configured.
-	// It is also possible to use the HASHICUPS_ environment variables instead,
-	// such as updating the Makefile and running the testing through that tool.
-	providerConfig = `
-        provider "newvm" {
-            username = "dummy@domain.tld"
-            password = "str0n9P4$$w0rD"
-            host     = "https://api.newvm.com"
-            totp     = ""
-        }
-    `
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
 )
 
 // testAccProtoV6ProviderFactories is used to instantiate a provider during acceptance testing.
@@ -47,3 +47,350 @@ func testAccPreCheck(t *testing.T) {
 	// about the appropriate environment variables being set are common to see in a pre-check
 	// function.
 }
+
+// testAccCheckOrdersEndDate verifies the end date of the orders of all
+// resources of resourceType on the fake API with check.
+func testAccCheckOrdersEndDate(s *newvmtest.Server, resourceType string, check func(endDate string) error) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		for _, rs := range state.RootModule().Resources {
+			if rs.Type != resourceType {
+				continue
+			}
+			orderID, err := strconv.Atoi(rs.Primary.ID)
+			if err != nil {
+				return err
+			}
+			order, ok := s.Order(orderID)
+			if !ok {
+				return fmt.Errorf("order %d not found", orderID)
+			}
+			if err := check(order.EndDate); err != nil {
+				return fmt.Errorf("order %d: %w", orderID, err)
+			}
+		}
+		return nil
+	}
+}
+
+// endDateSet is an end date check for orders that have been ended.
+func endDateSet(endDate string) error {
+	if endDate == "" {
+		return errors.New("expected an end date")
+	}
+	return nil
+}
+
+// endDateIs returns an end date check for the given end date, empty for
+// orders that keep running.
+func endDateIs(expected string) func(string) error {
+	return func(endDate string) error {
+		if endDate != expected {
+			return fmt.Errorf("expected end date %q, got %q", expected, endDate)
+		}
+		return nil
+	}
+}
+
+// testAccCheckOrderOption verifies the item count of an option of the
+// order behind resourceName on the fake API.
+func testAccCheckOrderOption(s *newvmtest.Server, resourceName, optionID string, count int) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		order, err := testAccOrder(s, state, resourceName)
+		if err != nil {
+			return err
+		}
+		if order.Options[optionID] != count {
+			return fmt.Errorf("order %d: expected %s = %d, got %d", order.ID, optionID, count, order.Options[optionID])
+		}
+		return nil
+	}
+}
+
+// testAccCheckVpcMembers verifies the number of VPCs the order behind
+// resourceName is a member of on the fake API.
+func testAccCheckVpcMembers(s *newvmtest.Server, resourceName string, count int) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		order, err := testAccOrder(s, state, resourceName)
+		if err != nil {
+			return err
+		}
+		if vpcs := s.VpcMembers(order.ID); len(vpcs) != count {
+			return fmt.Errorf("order %d: expected %d VPCs, got %v", order.ID, count, vpcs)
+		}
+		return nil
+	}
+}
+
+// testAccCheckVmProvisioned verifies that the uuid and ip_address of
+// resourceName are those of the running VM on the fake API.
+func testAccCheckVmProvisioned(s *newvmtest.Server, resourceName string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		order, err := testAccOrder(s, state, resourceName)
+		if err != nil {
+			return err
+		}
+		if order.VmStatus != "RUNNING" {
+			return fmt.Errorf("order %d: expected a running VM, got %q", order.ID, order.VmStatus)
+		}
+		return resource.ComposeAggregateTestCheckFunc(
+			resource.TestCheckResourceAttr(resourceName, "uuid", order.VmUUID),
+			resource.TestCheckResourceAttr(resourceName, "ip_address", order.VmIPAddress),
+		)(state)
+	}
+}
+
+// testAccCheckOrderPromoCodes verifies the promo codes the order behind
+// resourceName was placed with on the fake API.
+func testAccCheckOrderPromoCodes(s *newvmtest.Server, resourceName string, codes ...string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		order, err := testAccOrder(s, state, resourceName)
+		if err != nil {
+			return err
+		}
+		if !slices.Equal(order.PromoCodes, codes) {
+			return fmt.Errorf("order %d: expected promo codes %v, got %v", order.ID, codes, order.PromoCodes)
+		}
+		return nil
+	}
+}
+
+func testAccOrder(s *newvmtest.Server, state *terraform.State, resourceName string) (newvmtest.Order, error) {
+	rs, ok := state.RootModule().Resources[resourceName]
+	if !ok {
+		return newvmtest.Order{}, fmt.Errorf("resource %s not found in state", resourceName)
+	}
+	orderID, err := strconv.Atoi(rs.Primary.ID)
+	if err != nil {
+		return newvmtest.Order{}, err
+	}
+	order, ok := s.Order(orderID)
+	if !ok {
+		return newvmtest.Order{}, fmt.Errorf("order %d not found", orderID)
+	}
+	return order, nil
+}
+
+// configureTestProvider configures the provider with the given attributes,
+// the other attributes are null. The NEWVM_* environment variables are
+// cleared, so only the given attributes apply.
+func configureTestProvider(t *testing.T, attributes map[string]tftypes.Value) provider.ConfigureResponse {
+	t.Helper()
+
+	for _, name := range []string{"NEWVM_HOST", "NEWVM_USERNAME", "NEWVM_PASSWORD", "NEWVM_TOTP_SECRET", "NEWVM_TOKEN"} {
+		t.Setenv(name, "")
+	}
+
+	ctx := context.Background()
+	p := New("test")()
+	var schemaResp provider.SchemaResponse
+	p.Schema(ctx, provider.SchemaRequest{}, &schemaResp)
+	configType := schemaResp.Schema.Type().TerraformType(ctx).(tftypes.Object)
+	values := map[string]tftypes.Value{}
+	for name, attributeType := range configType.AttributeTypes {
+		values[name] = tftypes.NewValue(attributeType, nil)
+	}
+	maps.Copy(values, attributes)
+
+	var resp provider.ConfigureResponse
+	p.Configure(ctx, provider.ConfigureRequest{
+		Config: tfsdk.Config{Schema: schemaResp.Schema, Raw: tftypes.NewValue(configType, values)},
+	}, &resp)
+	return resp
+}
+
+// testProviderAttributes returns the attributes that configure the provider
+// against s, with extra attributes added or replaced.
+func testProviderAttributes(s *newvmtest.Server, extra map[string]tftypes.Value) map[string]tftypes.Value {
+	attributes := map[string]tftypes.Value{
+		"host":     tftypes.NewValue(tftypes.String, s.URL),
+		"username": tftypes.NewValue(tftypes.String, s.Username),
+		"password": tftypes.NewValue(tftypes.String, s.Password),
+	}
+	maps.Copy(attributes, extra)
+	return attributes
+}
+
+// errorPaths returns the attribute paths of the errors in diags, as strings.
+func errorPaths(diags diag.Diagnostics) []string {
+	var paths []string
+	for _, err := range diags.Errors() {
+		withPath, ok := err.(diag.DiagnosticWithPath)
+		if !ok {
+			paths = append(paths, "")
+			continue
+		}
+		paths = append(paths, withPath.Path().String())
+	}
+	return paths
+}
+
+func TestConfigurePollInterval(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	for value, valid := range map[string]bool{
+		"10ms": true,
+		"10s":  true,
+		"0s":   false,
+		"-1s":  false,
+		"soon": false,
+	} {
+		t.Run(value, func(t *testing.T) {
+			resp := configureTestProvider(t, testProviderAttributes(s, map[string]tftypes.Value{
+				"poll_interval": tftypes.NewValue(tftypes.String, value),
+			}))
+
+			if valid {
+				if resp.Diagnostics.HasError() {
+					t.Fatalf("expected poll_interval %q to be accepted, got %v", value, resp.Diagnostics.Errors())
+				}
+				if _, ok := resp.ResourceData.(*newvm.Client); !ok {
+					t.Fatalf("expected a client, got %T", resp.ResourceData)
+				}
+				return
+			}
+			if paths := errorPaths(resp.Diagnostics); !slices.Equal(paths, []string{"poll_interval"}) {
+				t.Fatalf("expected an error on poll_interval for %q, got %v", value, resp.Diagnostics.Errors())
+			}
+		})
+	}
+}
+
+func TestConfigureCatalogCacheTTL(t *testing.T) {
+	ctx := context.Background()
+
+	for value, expected := range map[string]int{
+		"5m": 1,
+		"0s": 3,
+	} {
+		t.Run(value, func(t *testing.T) {
+			s := newvmtest.NewServer(t)
+			resp := configureTestProvider(t, testProviderAttributes(s, map[string]tftypes.Value{
+				"catalog_cache_ttl": tftypes.NewValue(tftypes.String, value),
+			}))
+			if resp.Diagnostics.HasError() {
+				t.Fatalf("Configure: %v", resp.Diagnostics.Errors())
+			}
+			client := resp.ResourceData.(*newvm.Client)
+
+			for range 3 {
+				if _, err := client.GetLocations(ctx); err != nil {
+					t.Fatalf("GetLocations: %v", err)
+				}
+			}
+			fetches := 0
+			for _, request := range s.Requests() {
+				if request == "GET /backend/com.newvm.network/v1/location" {
+					fetches++
+				}
+			}
+			if fetches != expected {
+				t.Fatalf("expected %d location requests with catalog_cache_ttl %q, got %d", expected, value, fetches)
+			}
+		})
+	}
+}
+
+func TestConfigureAuthentication(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	token := s.NewToken()
+	value := func(value string) tftypes.Value {
+		return tftypes.NewValue(tftypes.String, value)
+	}
+
+	tests := []struct {
+		name       string
+		attributes map[string]tftypes.Value
+		errorPaths []string
+	}{
+		{
+			name:       "token",
+			attributes: map[string]tftypes.Value{"token": value(token)},
+		},
+		{
+			name:       "username and password",
+			attributes: map[string]tftypes.Value{"username": value(s.Username), "password": value(s.Password)},
+		},
+		{
+			name:       "token and password",
+			attributes: map[string]tftypes.Value{"token": value(token), "username": value(s.Username), "password": value(s.Password)},
+			errorPaths: []string{"token"},
+		},
+		{
+			name:       "token and TOTP secret",
+			attributes: map[string]tftypes.Value{"token": value(token), "totp_secret": value("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")},
+			errorPaths: []string{"token"},
+		},
+		{
+			name:       "neither",
+			attributes: map[string]tftypes.Value{},
+			errorPaths: []string{"username", "password"},
+		},
+		{
+			name:       "username without password",
+			attributes: map[string]tftypes.Value{"username": value(s.Username)},
+			errorPaths: []string{"password"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.attributes["host"] = value(s.URL)
+			resp := configureTestProvider(t, test.attributes)
+
+			if paths := errorPaths(resp.Diagnostics); !slices.Equal(paths, test.errorPaths) {
+				t.Fatalf("expected errors on %v, got %v", test.errorPaths, resp.Diagnostics.Errors())
+			}
+			if test.errorPaths != nil {
+				return
+			}
+			client, ok := resp.ResourceData.(*newvm.Client)
+			if !ok {
+				t.Fatalf("expected a client, got %T", resp.ResourceData)
+			}
+			if _, err := client.GetAllOrders(context.Background()); err != nil {
+				t.Fatalf("expected the client to be authenticated, got %v", err)
+			}
+		})
+	}
+}
+
+func TestConfigureRetry(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	retryType := tftypes.Object{AttributeTypes: map[string]tftypes.Type{
+		"max_attempts": tftypes.Number,
+		"min_backoff":  tftypes.String,
+		"max_backoff":  tftypes.String,
+	}}
+	retry := func(maxAttempts, minBackoff, maxBackoff any) map[string]tftypes.Value {
+		return map[string]tftypes.Value{"retry": tftypes.NewValue(retryType, map[string]tftypes.Value{
+			"max_attempts": tftypes.NewValue(tftypes.Number, maxAttempts),
+			"min_backoff":  tftypes.NewValue(tftypes.String, minBackoff),
+			"max_backoff":  tftypes.NewValue(tftypes.String, maxBackoff),
+		})}
+	}
+
+	tests := []struct {
+		name       string
+		retry      map[string]tftypes.Value
+		errorPaths []string
+	}{
+		{name: "defaults", retry: retry(nil, nil, nil)},
+		{name: "configured", retry: retry(2, "100ms", "1s")},
+		{name: "equal backoffs", retry: retry(nil, "2s", "2s")},
+		{name: "no retries", retry: retry(1, nil, nil)},
+		{name: "no attempts", retry: retry(0, nil, nil), errorPaths: []string{"retry.max_attempts"}},
+		{name: "min above max", retry: retry(nil, "10s", "1s"), errorPaths: []string{"retry.min_backoff"}},
+		{name: "min above default max", retry: retry(nil, "1m", nil), errorPaths: []string{"retry.min_backoff"}},
+		{name: "invalid max", retry: retry(nil, "1s", "soon"), errorPaths: []string{"retry.max_backoff"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := configureTestProvider(t, testProviderAttributes(s, test.retry))
+
+			if paths := errorPaths(resp.Diagnostics); !slices.Equal(paths, test.errorPaths) {
+				t.Fatalf("expected errors on %v, got %v", test.errorPaths, resp.Diagnostics.Errors())
+			}
+		})
+	}
+}
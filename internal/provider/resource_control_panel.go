@@ -4,22 +4,26 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"maps"
 	"strconv"
 	"time"
 
 	"unithost-terraform/internal/newvm"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
-	"github.com/hashicorp/terraform-plugin-framework/resource/schema/float64planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/setdefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/setplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
 // Ensure the implementation satisfies the expected interfaces.
@@ -29,6 +33,15 @@ var (
 	_ resource.ResourceWithImportState = &controlPanelResource{}
 )
 
+// Defaults for the timeouts block. Update waits for the change request to
+// be applied.
+const (
+	defaultControlPanelCreateTimeout = 20 * time.Minute
+	defaultControlPanelReadTimeout   = 5 * time.Minute
+	defaultControlPanelUpdateTimeout = 30 * time.Minute
+	defaultControlPanelDeleteTimeout = 10 * time.Minute
+)
+
 // NewControlPanelResource is a helper function to simplify the provider implementation.
 func NewControlPanelResource() resource.Resource {
 	return &controlPanelResource{}
@@ -43,16 +56,22 @@ type controlPanelExtensionResourceModel struct {
 
 // controlPanelResourceModel maps the resource schema data.
 type controlPanelResourceModel struct {
-	ID          types.Int64                          `tfsdk:"id"`
-	ProductID   types.String                         `tfsdk:"product_id"`
-	VmID        types.Int64                          `tfsdk:"vm_id"`
-	Extensions  []controlPanelExtensionResourceModel `tfsdk:"extensions"`
-	LastUpdated types.String                         `tfsdk:"last_updated"`
+	ID              types.Int64                          `tfsdk:"id"`
+	ProductID       types.String                         `tfsdk:"product_id"`
+	VmID            types.Int64                          `tfsdk:"vm_id"`
+	Extensions      []controlPanelExtensionResourceModel `tfsdk:"extensions"`
+	PromoCodes      types.Set                            `tfsdk:"promo_codes"`
+	ApplyChangesAt  types.String                         `tfsdk:"apply_changes_at"`
+	PendingChangeAt types.String                         `tfsdk:"pending_change_at"`
+	DeletionPolicy  types.String                         `tfsdk:"deletion_policy"`
+	EndDate         types.String                         `tfsdk:"end_date"`
+	LastUpdated     types.String                         `tfsdk:"last_updated"`
+	Timeouts        timeouts.Value                       `tfsdk:"timeouts"`
 }
 
 // controlPanelResource is the resource implementation.
 type controlPanelResource struct {
-	client *newvm.Client
+	client newvm.API
 }
 
 // Metadata returns the resource type name.
@@ -61,7 +80,7 @@ func (r *controlPanelResource) Metadata(_ context.Context, req resource.Metadata
 }
 
 // Schema defines the schema for the resource.
-func (r *controlPanelResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+func (r *controlPanelResource) Schema(ctx context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
 	// Used to construct empty list default for extensions
 	var extensionObjectType = types.ObjectType{
 		AttrTypes: map[string]attr.Type{
@@ -110,25 +129,36 @@ func (r *controlPanelResource) Schema(_ context.Context, _ resource.SchemaReques
 						"description": schema.StringAttribute{
 							Description: "description of the control panel extension.",
 							Computed:    true,
-							PlanModifiers: []planmodifier.String{
-								stringplanmodifier.UseStateForUnknown(),
-							},
 						},
 						"price": schema.Float64Attribute{
 							Description: "price of the control panel extension.",
 							Computed:    true,
-							PlanModifiers: []planmodifier.Float64{
-								float64planmodifier.UseStateForUnknown(),
-							},
 						},
 					},
 				},
 			},
+			"promo_codes":       promoCodesAttribute(),
+			"apply_changes_at":  applyChangesAtAttribute(controlPanelChangeRequest),
+			"pending_change_at": pendingChangeAtAttribute(),
+			"deletion_policy": deletionPolicyAttribute(
+				"What destroying the control panel does: 'end_of_billing_period' (default) ends its order on the last day it is billed for, "+
+					"and 'immediate' ends it today. End dates are calculated in the billing_timezone of the provider.",
+				newvm.DeletionPolicyEndOfBillingPeriod, newvm.DeletionPolicyImmediate,
+			),
+			"end_date": endDateAttribute(),
 			"last_updated": schema.StringAttribute{
 				Description: "Timestamp of the last Terraform update of the control panel.",
 				Computed:    true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -142,12 +172,24 @@ func (r *controlPanelResource) Create(ctx context.Context, req resource.CreateRe
 		return
 	}
 
+	createTimeout, diags := plan.Timeouts.Create(ctx, defaultControlPanelCreateTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	// Generate API request body from plan
 	newControlPanelOrder := newvm.ControlPanel{
 		ID:         int(plan.ID.ValueInt64()),
 		ProductID:  plan.ProductID.ValueString(),
 		VmID:       int(plan.VmID.ValueInt64()),
 		Extensions: []newvm.ControlPanelExtension{},
+		PromoCodes: promoCodesFromPlan(ctx, plan.PromoCodes, &resp.Diagnostics),
+	}
+	if resp.Diagnostics.HasError() {
+		return
 	}
 	for _, extension := range plan.Extensions {
 		newControlPanelOrder.Extensions = append(newControlPanelOrder.Extensions, newvm.ControlPanelExtension{
@@ -158,21 +200,25 @@ func (r *controlPanelResource) Create(ctx context.Context, req resource.CreateRe
 	}
 
 	// Create new control panel
-	controlPanel, err := r.client.CreateControlPanel(newControlPanelOrder)
+	controlPanel, err := r.client.CreateControlPanel(ctx, newControlPanelOrder)
 	if err != nil {
-		resp.Diagnostics.AddError(
+		addCreateError(&resp.Diagnostics,
 			"Error creating control panel",
-			"Could not create control panel, unexpected error: "+err.Error(),
+			"Could not create control panel, unexpected error: ",
+			newControlPanelOrder.PromoCodes,
+			err,
 		)
 		return
 	}
 
 	// Map response body to schema and populate Computed attribute values
 	plan.ID = types.Int64Value(int64(controlPanel.ID))
+	plan.PendingChangeAt = types.StringValue("")
+	plan.EndDate = types.StringValue("")
 	plan.LastUpdated = types.StringValue(time.Now().Format(time.RFC850))
 
 	// Try to read back; if API not ready, union preserves planned items
-	if cp, err := r.client.GetControlPanel(int64(controlPanel.ID)); err == nil {
+	if cp, err := r.client.GetControlPanel(ctx, int64(controlPanel.ID)); err == nil {
 		plan.Extensions = mergeExtensionsByID(plan.Extensions, cp.Extensions)
 	} else {
 		// normalize unknowns so no unknowns remain after apply
@@ -198,12 +244,25 @@ func (r *controlPanelResource) Read(ctx context.Context, req resource.ReadReques
 		return
 	}
 
+	readTimeout, diags := state.Timeouts.Read(ctx, defaultControlPanelReadTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
 	controlPanelId := state.ID.ValueInt64()
 	if controlPanelId > 0 {
 		log.Println("Reading control panel: ", controlPanelId)
 
 		// Get refreshed control panel value from NewVM
-		controlPanel, err := r.client.GetControlPanel(controlPanelId)
+		controlPanel, err := r.client.GetControlPanel(ctx, controlPanelId)
+		if newvm.IsNotFound(err) {
+			tflog.Warn(ctx, "Control panel no longer exists, removing it from state", map[string]any{"id": controlPanelId})
+			resp.State.RemoveResource(ctx)
+			return
+		}
 		if err != nil {
 			resp.Diagnostics.AddError(
 				"Error Reading control panel",
@@ -218,6 +277,9 @@ func (r *controlPanelResource) Read(ctx context.Context, req resource.ReadReques
 		// Merge API into current state; if API omits an extension briefly,
 		// the union keeps it instead of dropping it and causing thrash.
 		state.Extensions = mergeExtensionsByID(state.Extensions, controlPanel.Extensions)
+		state.PendingChangeAt = types.StringValue(controlPanel.PendingChangeAt)
+		state.EndDate = types.StringValue(controlPanel.EndDate)
+		state.DeletionPolicy = types.StringValue(string(deletionPolicyFromState(state.DeletionPolicy)))
 
 		// Set refreshed state
 		diags = resp.State.Set(ctx, &state)
@@ -244,11 +306,21 @@ func (r *controlPanelResource) Update(ctx context.Context, req resource.UpdateRe
 		return
 	}
 
+	updateTimeout, diags := plan.Timeouts.Update(ctx, defaultControlPanelUpdateTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	// Generate API request body from plan
 	newControlPanelOrder := newvm.ControlPanel{
 		ProductID:  plan.ProductID.ValueString(),
 		VmID:       int(plan.VmID.ValueInt64()),
 		Extensions: []newvm.ControlPanelExtension{},
+
+		ApplyChangesAt: plan.ApplyChangesAt.ValueString(),
 	}
 	for _, extension := range plan.Extensions {
 		newControlPanelOrder.Extensions = append(newControlPanelOrder.Extensions, newvm.ControlPanelExtension{
@@ -258,24 +330,34 @@ func (r *controlPanelResource) Update(ctx context.Context, req resource.UpdateRe
 		})
 	}
 
-	// Update existing control panel
-	_, err := r.client.UpdateControlPanel(plan.ID.ValueInt64(), newControlPanelOrder)
-	if err != nil {
-		resp.Diagnostics.AddError(
-			"Error Updating NewVM control panel",
-			"Could not update control panel, unexpected error: "+err.Error(),
-		)
-		return
+	// Update existing control panel, this waits for the change request to be
+	// applied unless it is scheduled. Other changes, like promo codes, do not
+	// need a change request.
+	changed := changedControlPanelAttributes(prior, plan)
+	if len(changed) > 0 {
+		_, err := r.client.UpdateControlPanel(ctx, plan.ID.ValueInt64(), newControlPanelOrder)
+		if err != nil {
+			addUpdateError(&resp.Diagnostics,
+				"Error Updating NewVM control panel",
+				"Could not update control panel, unexpected error: ",
+				err,
+				changed,
+			)
+			return
+		}
 	}
 
-	cp, err := r.client.GetControlPanel(plan.ID.ValueInt64())
+	cp, err := r.client.GetControlPanel(ctx, plan.ID.ValueInt64())
 	if err != nil {
-		// fallback: keep plan (normalized) so elements don't "vanish"
+		// fallback: keep plan (normalized) so elements don't "vanish",
+		// the pending change is refreshed on the next Read
 		plan.Extensions = mergeExtensionsByID(plan.Extensions, nil)
+		plan.PendingChangeAt = types.StringValue("")
 	} else {
 		plan.Extensions = mergeExtensionsByID(plan.Extensions, cp.Extensions)
 		plan.VmID = types.Int64Value(int64(cp.VmID))
 		plan.ProductID = types.StringValue(cp.ProductID)
+		plan.PendingChangeAt = types.StringValue(cp.PendingChangeAt)
 	}
 	plan.LastUpdated = types.StringValue(time.Now().Format(time.RFC850))
 
@@ -294,10 +376,23 @@ func (r *controlPanelResource) Delete(ctx context.Context, req resource.DeleteRe
 	if resp.Diagnostics.HasError() {
 		return
 	}
+
+	deleteTimeout, diags := state.Timeouts.Delete(ctx, defaultControlPanelDeleteTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	controlPanelID := state.ID.ValueInt64()
 	if controlPanelID > 0 {
 		// Delete existing control panel
-		err := r.client.DeleteControlPanel(controlPanelID)
+		endDate, err := r.client.DeleteControlPanel(ctx, controlPanelID, deletionPolicyFromState(state.DeletionPolicy))
+		if newvm.IsNotFound(err) {
+			tflog.Warn(ctx, "Control panel no longer exists, removing it from state", map[string]any{"id": controlPanelID})
+			return
+		}
 		if err != nil {
 			resp.Diagnostics.AddError(
 				"Error Deleting control panel",
@@ -305,6 +400,7 @@ func (r *controlPanelResource) Delete(ctx context.Context, req resource.DeleteRe
 			)
 			return
 		}
+		addDeletionWarning(&resp.Diagnostics, "Control Panel", strconv.FormatInt(controlPanelID, 10), endDate)
 	} else {
 		resp.Diagnostics.AddError(
 			"Error Deleting control panel",
@@ -322,12 +418,12 @@ func (r *controlPanelResource) Configure(_ context.Context, req resource.Configu
 		return
 	}
 
-	client, ok := req.ProviderData.(*newvm.Client)
+	client, ok := req.ProviderData.(newvm.API)
 
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *newvm.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected newvm.API, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
@@ -337,8 +433,49 @@ func (r *controlPanelResource) Configure(_ context.Context, req resource.Configu
 }
 
 func (r *controlPanelResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
-	// Retrieve import ID and save to id attribute
-	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+	// Retrieve import ID and save to the numeric id attribute
+	controlPanelID, err := strconv.ParseInt(req.ID, 10, 64)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unexpected Import Identifier",
+			fmt.Sprintf("Expected the numeric order number of the control panel, got: %q", req.ID),
+		)
+		return
+	}
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("id"), controlPanelID)...)
+}
+
+// controlPanelChangeRequest returns the attributes a plan of the control
+// panel changes through a change request, none when it is replaced.
+func controlPanelChangeRequest(ctx context.Context, plan tfsdk.Plan, state tfsdk.State) ([]path.Path, diag.Diagnostics) {
+	var planned, prior controlPanelResourceModel
+	diags := plan.Get(ctx, &planned)
+	diags.Append(state.Get(ctx, &prior)...)
+	if diags.HasError() || !planned.VmID.Equal(prior.VmID) {
+		return nil, diags
+	}
+	return changedControlPanelAttributes(prior, planned), diags
+}
+
+// changedControlPanelAttributes returns the paths of the attributes that are
+// changed through a change request.
+func changedControlPanelAttributes(prior, plan controlPanelResourceModel) []path.Path {
+	var changed []path.Path
+	if !plan.ProductID.Equal(prior.ProductID) {
+		changed = append(changed, path.Root("product_id"))
+	}
+	priorIDs := map[string]bool{}
+	for _, extension := range prior.Extensions {
+		priorIDs[extension.ID.ValueString()] = true
+	}
+	planIDs := map[string]bool{}
+	for _, extension := range plan.Extensions {
+		planIDs[extension.ID.ValueString()] = true
+	}
+	if !maps.Equal(priorIDs, planIDs) {
+		changed = append(changed, path.Root("extensions"))
+	}
+	return changed
 }
 
 // mergeExtensionsByID returns a stable union of plan and api by extension ID.
@@ -0,0 +1,411 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+)
+
+// newTestControlPanelState returns the state of control panel order 1002 on
+// VM order 1001, changed by changes. Its extensions are the empty default.
+func newTestControlPanelState(changes ...func(*controlPanelResourceModel)) controlPanelResourceModel {
+	m := controlPanelResourceModel{
+		ID:              types.Int64Value(1002),
+		ProductID:       types.StringValue("CP_PLESK.plesk_12_license.1"),
+		VmID:            types.Int64Value(1001),
+		Extensions:      []controlPanelExtensionResourceModel{},
+		PromoCodes:      types.SetNull(types.StringType),
+		PendingChangeAt: types.StringValue(""),
+		EndDate:         types.StringValue(""),
+		LastUpdated:     types.StringValue(""),
+	}
+	for _, change := range changes {
+		change(&m)
+	}
+	return m
+}
+
+// withExtension adds the WordPress extension with description and price.
+func withExtension(description types.String, price types.Float64) func(*controlPanelResourceModel) {
+	return func(m *controlPanelResourceModel) {
+		m.Extensions = append(m.Extensions, controlPanelExtensionResourceModel{ID: types.StringValue("wordpress"), Description: description, Price: price})
+	}
+}
+
+func TestControlPanelResource(t *testing.T) {
+	withControlPanel := func(extensions ...newvm.ControlPanelExtension) func(api *fakeAPI) {
+		return func(api *fakeAPI) {
+			api.controlPanels[1002] = newvm.ControlPanel{ID: 1002, VmID: 1001, ProductID: "CP_PLESK.plesk_12_license.1", Extensions: extensions}
+		}
+	}
+	// extensions are planned without description and price, Create and
+	// Update read them from the API
+	planned := withExtension(types.StringUnknown(), types.Float64Unknown())
+	wordpress := newvm.ControlPanelExtension{ID: "wordpress", Description: "WordPress Toolkit", Price: 4.5}
+	// Read fills in the deletion policy of a state that lacks it
+	refreshed := func(m *controlPanelResourceModel) {
+		m.DeletionPolicy = types.StringValue(string(newvm.DeletionPolicyEndOfBillingPeriod))
+	}
+
+	runResourceTests(t, func(api *fakeAPI) fwresource.Resource { return &controlPanelResource{client: api} }, []resourceTest{
+		{
+			name:   "create",
+			setup:  func(api *fakeAPI) { api.nextOrderID = 1001 },
+			method: "Create",
+			plan: newTestControlPanelState(planned, func(m *controlPanelResourceModel) {
+				m.ID = types.Int64Unknown()
+				m.PendingChangeAt = types.StringUnknown()
+				m.EndDate = types.StringUnknown()
+				m.LastUpdated = types.StringUnknown()
+			}),
+			calls: []string{"CreateControlPanel", "GetControlPanel"},
+			expected: newTestControlPanelState(withExtension(types.StringValue(""), types.Float64Value(0)), func(m *controlPanelResourceModel) {
+				m.LastUpdated = types.StringValue("(now)")
+			}),
+		},
+		{
+			name:     "read",
+			setup:    withControlPanel(wordpress),
+			method:   "Read",
+			state:    newTestControlPanelState(withExtension(types.StringNull(), types.Float64Null())),
+			calls:    []string{"GetControlPanel"},
+			expected: newTestControlPanelState(refreshed, withExtension(types.StringValue("WordPress Toolkit"), types.Float64Value(4.5))),
+		},
+		{
+			name:   "read deleted control panel",
+			method: "Read",
+			state:  newTestControlPanelState(),
+			calls:  []string{"GetControlPanel"},
+		},
+		{
+			name:   "update",
+			setup:  withControlPanel(),
+			method: "Update",
+			state:  newTestControlPanelState(),
+			plan:   newTestControlPanelState(planned),
+			calls:  []string{"UpdateControlPanel", "GetControlPanel"},
+			expected: newTestControlPanelState(withExtension(types.StringValue(""), types.Float64Value(0)), func(m *controlPanelResourceModel) {
+				m.LastUpdated = types.StringValue("(now)")
+			}),
+		},
+		{
+			// promo codes only apply to new orders, they need no change request
+			name:   "update promo codes",
+			setup:  withControlPanel(),
+			method: "Update",
+			state:  newTestControlPanelState(),
+			plan: newTestControlPanelState(func(m *controlPanelResourceModel) {
+				m.PromoCodes = types.SetValueMust(types.StringType, []attr.Value{types.StringValue("SPRING")})
+			}),
+			calls: []string{"GetControlPanel"},
+			expected: newTestControlPanelState(func(m *controlPanelResourceModel) {
+				m.PromoCodes = types.SetValueMust(types.StringType, []attr.Value{types.StringValue("SPRING")})
+				m.LastUpdated = types.StringValue("(now)")
+			}),
+		},
+		{
+			// the provisioning error is reported on the changed attribute
+			name: "update with failed change request",
+			setup: func(api *fakeAPI) {
+				withControlPanel()(api)
+				api.changeErr = &newvm.ChangeRequestError{OrderID: 1002, ChangeRequestID: 7, Message: "license unavailable"}
+			},
+			method:   "Update",
+			state:    newTestControlPanelState(),
+			plan:     newTestControlPanelState(planned),
+			calls:    []string{"UpdateControlPanel"},
+			errors:   []string{"extensions"},
+			expected: newTestControlPanelState(),
+		},
+		{
+			name:   "delete",
+			setup:  withControlPanel(),
+			method: "Delete",
+			state:  newTestControlPanelState(),
+			calls:  []string{"DeleteControlPanel"},
+		},
+		{
+			// an order removed outside of Terraform must not keep the control panel in state
+			name:   "delete deleted control panel",
+			method: "Delete",
+			state:  newTestControlPanelState(),
+			calls:  []string{"DeleteControlPanel"},
+		},
+	})
+}
+
+func TestControlPanelResourceImportState(t *testing.T) {
+	ctx := context.Background()
+	r := &controlPanelResource{client: newFakeAPI()}
+
+	// id is a number attribute, the import ID must be parsed rather than passed through
+	resp := fwresource.ImportStateResponse{State: newTestState(t, r, nil)}
+	r.ImportState(ctx, fwresource.ImportStateRequest{ID: "1001"}, &resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("ImportState: %v", resp.Diagnostics.Errors())
+	}
+	var id types.Int64
+	resp.State.GetAttribute(ctx, path.Root("id"), &id)
+	if id.ValueInt64() != 1001 {
+		t.Fatalf("ImportState: expected id 1001, got %s", id)
+	}
+
+	resp = fwresource.ImportStateResponse{State: newTestState(t, r, nil)}
+	r.ImportState(ctx, fwresource.ImportStateRequest{ID: "plesk"}, &resp)
+	if !resp.Diagnostics.HasError() {
+		t.Fatal("ImportState: expected an error for a non-numeric import ID")
+	}
+}
+
+func TestControlPanelResourceExtensionsSchema(t *testing.T) {
+	s := resourceSchema(t, &controlPanelResource{})
+
+	// Set elements are matched by value, so a swapped extension has no
+	// prior state of its own: its description and price must stay
+	// unknown until Create or Update reads them from the API.
+	extensions := s.Attributes["extensions"].(schema.SetNestedAttribute)
+	if modifiers := extensions.NestedObject.Attributes["description"].(schema.StringAttribute).PlanModifiers; len(modifiers) != 0 {
+		t.Fatalf("expected no plan modifiers on extensions.description, got %v", modifiers)
+	}
+	if modifiers := extensions.NestedObject.Attributes["price"].(schema.Float64Attribute).PlanModifiers; len(modifiers) != 0 {
+		t.Fatalf("expected no plan modifiers on extensions.price, got %v", modifiers)
+	}
+}
+
+func TestAccControlPanelResource(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	config := func(product string, extensions ...string) string {
+		blocks := ""
+		for _, extension := range extensions {
+			blocks += fmt.Sprintf("{ id = %q },", extension)
+		}
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product  = "VM-A1"
+  os       = "debian-12"
+  hostname = "web1.example.com"
+}
+
+resource "newvm_control_panel" "plesk" {
+  vm_id      = newvm_vm.web.id
+  product_id = %q
+  extensions = [%s]
+}
+`, product, blocks)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_control_panel", endDateSet),
+		Steps: []resource.TestStep{
+			// Create and Read testing
+			{
+				Config: config("CP_PLESK.plesk_12_license.1", "plesk_extension_dnssec"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrSet("newvm_control_panel.plesk", "id"),
+					resource.TestCheckResourceAttrPair("newvm_control_panel.plesk", "vm_id", "newvm_vm.web", "id"),
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "product_id", "CP_PLESK.plesk_12_license.1"),
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "extensions.#", "1"),
+					resource.TestCheckTypeSetElemNestedAttrs("newvm_control_panel.plesk", "extensions.*", map[string]string{
+						"id":          "plesk_extension_dnssec",
+						"description": "DNSSEC",
+					}),
+					testAccCheckOrderOption(s, "newvm_control_panel.plesk", "plesk_extension_dnssec", 1),
+				),
+			},
+			// ImportState testing
+			{
+				ResourceName:            "newvm_control_panel.plesk",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"last_updated"},
+			},
+			// Swap an extension and upgrade the license
+			{
+				Config: config("CP_PLESK.plesk_12_license.2", "plesk_extension_hosting_pack"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "product_id", "CP_PLESK.plesk_12_license.2"),
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "extensions.#", "1"),
+					resource.TestCheckTypeSetElemNestedAttrs("newvm_control_panel.plesk", "extensions.*", map[string]string{
+						"id": "plesk_extension_hosting_pack",
+					}),
+					testAccCheckOrderOption(s, "newvm_control_panel.plesk", "plesk_12_license", 2),
+					testAccCheckOrderOption(s, "newvm_control_panel.plesk", "plesk_extension_dnssec", 0),
+					testAccCheckOrderOption(s, "newvm_control_panel.plesk", "plesk_extension_hosting_pack", 1),
+				),
+			},
+			// Remove all extensions
+			{
+				Config: config("CP_PLESK.plesk_12_license.2"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "extensions.#", "0"),
+					testAccCheckOrderOption(s, "newvm_control_panel.plesk", "plesk_extension_hosting_pack", 0),
+				),
+			},
+			// Delete testing automatically occurs in TestCase
+		},
+	})
+}
+
+func TestAccControlPanelResourcePromoCodes(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	s.AddPromoCodes("WELCOME10", "SPRING")
+
+	config := func(promoCode string) string {
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product  = "VM-A1"
+  os       = "debian-12"
+  hostname = "web1.example.com"
+}
+
+resource "newvm_control_panel" "plesk" {
+  vm_id       = newvm_vm.web.id
+  product_id  = "CP_PLESK.plesk_12_license.1"
+  promo_codes = [%q]
+}
+`, promoCode)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_control_panel", endDateSet),
+		Steps: []resource.TestStep{
+			{
+				Config: config("WELCOME10"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckOrderPromoCodes(s, "newvm_control_panel.plesk", "WELCOME10"),
+				),
+			},
+			// Promo codes only apply to new orders, no change request is placed
+			{
+				Config: config("SPRING"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckTypeSetElemAttr("newvm_control_panel.plesk", "promo_codes.*", "SPRING"),
+					testAccCheckOrderPromoCodes(s, "newvm_control_panel.plesk", "WELCOME10"),
+					func(*terraform.State) error {
+						for _, request := range s.Requests() {
+							if strings.HasPrefix(request, "PUT /account/v1/order/") {
+								return fmt.Errorf("expected no change request, got %s", request)
+							}
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccControlPanelResourceScheduledChange(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	applyAt := time.Now().UTC().Add(2 * time.Hour).Truncate(time.Second).Format(time.RFC3339)
+
+	config := func(product string) string {
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product  = "VM-A1"
+  os       = "debian-12"
+  hostname = "web1.example.com"
+}
+
+resource "newvm_control_panel" "plesk" {
+  vm_id            = newvm_vm.web.id
+  product_id       = %q
+  extensions       = [{ id = "plesk_extension_dnssec" }]
+  apply_changes_at = %q
+
+  timeouts {
+    update = "5s"
+  }
+}
+`, product, applyAt)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_control_panel", endDateSet),
+		Steps: []resource.TestStep{
+			{
+				Config: config("CP_PLESK.plesk_12_license.1"),
+			},
+			// The upgrade is scheduled, the state shows it as pending without a diff
+			{
+				Config: config("CP_PLESK.plesk_12_license.2"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "product_id", "CP_PLESK.plesk_12_license.2"),
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "extensions.#", "1"),
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "pending_change_at", applyAt),
+					testAccCheckOrderOption(s, "newvm_control_panel.plesk", "plesk_12_license", 1),
+				),
+			},
+			{
+				PreConfig: s.ApplyChanges,
+				Config:    config("CP_PLESK.plesk_12_license.2"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "pending_change_at", ""),
+					testAccCheckOrderOption(s, "newvm_control_panel.plesk", "plesk_12_license", 2),
+				),
+			},
+		},
+	})
+}
+
+func TestAccControlPanelResourceDeletionPolicy(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	amsterdam, err := time.LoadLocation(newvm.DefaultBillingTimezone)
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+
+	config := func(deletionPolicy string) string {
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product  = "VM-A1"
+  os       = "debian-12"
+  hostname = "web1.example.com"
+}
+
+resource "newvm_control_panel" "plesk" {
+  vm_id           = newvm_vm.web.id
+  product_id      = "CP_PLESK.plesk_12_license.1"
+  extensions      = [{ id = "plesk_extension_dnssec" }]
+  deletion_policy = %q
+}
+`, deletionPolicy)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_control_panel", endDateIs(time.Now().In(amsterdam).Format(time.DateOnly))),
+		Steps: []resource.TestStep{
+			// Control panels have no VM to stop
+			{
+				Config:      config("stop_only"),
+				ExpectError: regexp.MustCompile(`Invalid Deletion Policy`),
+			},
+			{
+				Config: config("immediate"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "deletion_policy", "immediate"),
+					resource.TestCheckResourceAttr("newvm_control_panel.plesk", "end_date", ""),
+				),
+			},
+		},
+	})
+}
@@ -2,23 +2,30 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"unithost-terraform/internal/newvm"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
 // Ensure the implementation satisfies the expected interfaces.
@@ -28,6 +35,15 @@ var (
 	_ resource.ResourceWithImportState = &vmResource{}
 )
 
+// Defaults for the timeouts block. Create waits for a new VM to be
+// provisioned, and Update for its change request to be applied.
+const (
+	defaultVmCreateTimeout = 30 * time.Minute
+	defaultVmReadTimeout   = 5 * time.Minute
+	defaultVmUpdateTimeout = 30 * time.Minute
+	defaultVmDeleteTimeout = 10 * time.Minute
+)
+
 // NewVmResource is a helper function to simplify the provider implementation.
 func NewVmResource() resource.Resource {
 	return &vmResource{}
@@ -35,29 +51,39 @@ func NewVmResource() resource.Resource {
 
 // vmResourceModel maps the resource schema data.
 type vmResourceModel struct {
-	ID          types.String `tfsdk:"id"`
-	VmProductID types.String `tfsdk:"product"`
-	Os          types.String `tfsdk:"os"`
-	Hostname    types.String `tfsdk:"hostname"`
-	Location    types.String `tfsdk:"location"`
-	Ram         types.Int64  `tfsdk:"ram"`
-	Cores       types.Int64  `tfsdk:"cores"`
-	Disk        types.Int64  `tfsdk:"disk"`
-	Comments    types.String `tfsdk:"comments"`
-	SshKey      types.String `tfsdk:"ssh_key"`
-	IsVpcOnly   types.Bool   `tfsdk:"is_vpc_only"`
-	UseDhcp     types.Bool   `tfsdk:"use_dhcp"`
-	Vpc         types.List   `tfsdk:"vpc"`
-	IpAddress   types.String `tfsdk:"ip_address"`
-	SubnetMask  types.String `tfsdk:"subnet_mask"`
-	Gateway     types.String `tfsdk:"gateway"`
-	DnsServer   types.String `tfsdk:"dns_server"`
-	LastUpdated types.String `tfsdk:"last_updated"`
+	ID              types.String   `tfsdk:"id"`
+	Uuid            types.String   `tfsdk:"uuid"`
+	VmProductID     types.String   `tfsdk:"product"`
+	Os              types.String   `tfsdk:"os"`
+	Hostname        types.String   `tfsdk:"hostname"`
+	Location        types.String   `tfsdk:"location"`
+	Ram             types.Int64    `tfsdk:"ram"`
+	Cores           types.Int64    `tfsdk:"cores"`
+	Disk            types.Int64    `tfsdk:"disk"`
+	Comments        types.String   `tfsdk:"comments"`
+	Description     types.String   `tfsdk:"description"`
+	SshKey          types.String   `tfsdk:"ssh_key"`
+	IsVpcOnly       types.Bool     `tfsdk:"is_vpc_only"`
+	UseDhcp         types.Bool     `tfsdk:"use_dhcp"`
+	Vpc             types.List     `tfsdk:"vpc"`
+	IpAddress       types.String   `tfsdk:"ip_address"`
+	SubnetMask      types.String   `tfsdk:"subnet_mask"`
+	Gateway         types.String   `tfsdk:"gateway"`
+	DnsServer       types.String   `tfsdk:"dns_server"`
+	PromoCodes      types.Set      `tfsdk:"promo_codes"`
+	ClientReference types.String   `tfsdk:"client_reference"`
+	ApplyChangesAt  types.String   `tfsdk:"apply_changes_at"`
+	PendingChangeAt types.String   `tfsdk:"pending_change_at"`
+	DeletionPolicy  types.String   `tfsdk:"deletion_policy"`
+	EndDate         types.String   `tfsdk:"end_date"`
+	EndChildOrders  types.Bool     `tfsdk:"end_child_orders"`
+	LastUpdated     types.String   `tfsdk:"last_updated"`
+	Timeouts        timeouts.Value `tfsdk:"timeouts"`
 }
 
 // vmResource is the resource implementation.
 type vmResource struct {
-	client *newvm.Client
+	client newvm.API
 }
 
 // Metadata returns the resource type name.
@@ -66,7 +92,7 @@ func (r *vmResource) Metadata(_ context.Context, req resource.MetadataRequest, r
 }
 
 // Schema defines the schema for the resource.
-func (r *vmResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+func (r *vmResource) Schema(ctx context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
 	resp.Schema = schema.Schema{
 		Description: "Manages a VM.",
 		Attributes: map[string]schema.Attribute{
@@ -77,6 +103,13 @@ func (r *vmResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *r
 					stringplanmodifier.UseStateForUnknown(),
 				},
 			},
+			"uuid": schema.StringAttribute{
+				Description: "UUID of the provisioned VM.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
 			"product": schema.StringAttribute{
 				Description: "product ID of the VM. (eg. 'VM-A1' or 'VM-B3')",
 				Required:    true,
@@ -137,12 +170,23 @@ func (r *vmResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *r
 				},
 			},
 			"comments": schema.StringAttribute{
-				Description: "Comments for the VM order.",
+				Description: "Comments for the VM order. Changing them orders a new VM.",
 				Optional:    true,
 				Computed:    true,
 				Default:     stringdefault.StaticString(""),
 				PlanModifiers: []planmodifier.String{
 					stringplanmodifier.UseStateForUnknown(),
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"description": schema.StringAttribute{
+				Description: "Custom description of the VM order, shown in the NewVM portal. Changing it orders a new VM.",
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString(""),
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+					stringplanmodifier.RequiresReplace(),
 				},
 			},
 			"ssh_key": schema.StringAttribute{
@@ -213,11 +257,46 @@ func (r *vmResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *r
 					stringplanmodifier.UseStateForUnknown(),
 				},
 			},
+			"promo_codes":       promoCodesAttribute(),
+			"apply_changes_at":  applyChangesAtAttribute(vmChangeRequest),
+			"pending_change_at": pendingChangeAtAttribute(),
+			"client_reference": schema.StringAttribute{
+				Description: "Reference the VM is ordered with. When NewVM accepted the order but its response was lost, the order with this " +
+					"reference is adopted instead of ordering the VM again. Defaults to a random reference generated when the VM is created, " +
+					"a configured one must be unique to this VM. Changing it later does not change the existing order.",
+				Optional: true,
+				Computed: true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"deletion_policy": deletionPolicyAttribute(
+				"What destroying the VM does: 'end_of_billing_period' (default) stops the VM and ends its order on the last day it is billed for, "+
+					"'immediate' stops the VM and ends its order today, and 'stop_only' stops the VM but keeps the order running. "+
+					"End dates are calculated in the billing_timezone of the provider.",
+				newvm.DeletionPolicyEndOfBillingPeriod, newvm.DeletionPolicyImmediate, newvm.DeletionPolicyStopOnly,
+			),
+			"end_date": endDateAttribute(),
+			"end_child_orders": schema.BoolAttribute{
+				Description: "End the running child orders of the VM, such as control panels, together with the VM when it is destroyed. " +
+					"Defaults to false, which refuses to destroy a VM that has running child orders and lists them instead.",
+				Optional: true,
+				Computed: true,
+				Default:  booldefault.StaticBool(false),
+			},
 			"last_updated": schema.StringAttribute{
 				Description: "Timestamp of the last Terraform update of the VM.",
 				Computed:    true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -257,22 +336,82 @@ func (r *vmResource) Create(ctx context.Context, req resource.CreateRequest, res
 		SubnetMask:  plan.SubnetMask.ValueString(),
 		Gateway:     plan.Gateway.ValueString(),
 		DnsServer:   plan.DnsServer.ValueString(),
+		Comments:    plan.Comments.ValueString(),
+		Description: plan.Description.ValueString(),
+		PromoCodes:  promoCodesFromPlan(ctx, plan.PromoCodes, &resp.Diagnostics),
+	}
+	// a reference of its own, so an order found by it can only be this VM's
+	if plan.ClientReference.IsUnknown() {
+		plan.ClientReference = types.StringValue(newvm.NewReference())
+	}
+	newVmOrder.Reference = plan.ClientReference.ValueString()
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := plan.Timeouts.Create(ctx, defaultVmCreateTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
 	}
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
 
 	// Create new vm
-	vm, err := r.client.CreateVm(newVmOrder)
-	if err != nil {
+	vm, err := r.client.CreateVm(ctx, newVmOrder)
+	var notConfirmedErr *newvm.OrderNotConfirmedError
+	if errors.As(err, &notConfirmedErr) {
+		// keep the reference in state, so the order is looked up by it instead of ordering again
+		plan.ID = types.StringValue("")
+		plan.Uuid = types.StringValue("")
+		if plan.IpAddress.IsUnknown() {
+			plan.IpAddress = types.StringValue("")
+		}
+		plan.PendingChangeAt = types.StringValue("")
+		plan.EndDate = types.StringValue("")
+		plan.LastUpdated = types.StringValue(time.Now().Format(time.RFC850))
+		resp.Diagnostics.Append(resp.State.Set(ctx, plan)...)
 		resp.Diagnostics.AddError(
 			"Error creating VM",
-			"Could not create VM, unexpected error: "+err.Error(),
+			"Could not create VM, NewVM may have placed the order: "+err.Error()+"\n\n"+
+				"The next refresh looks the order up by client_reference "+notConfirmedErr.Reference+". Terraform marks the VM as tainted, "+
+				"run terraform untaint after a refresh found its order to keep it instead of replacing it.",
 		)
 		return
 	}
+	if err != nil {
+		addCreateVmError(&resp.Diagnostics, newVmOrder.PromoCodes, err)
+		return
+	}
 
 	// Map response body to schema and populate Computed attribute values
 	plan.ID = types.StringValue(strconv.Itoa(vm.OrderID))
+	plan.PendingChangeAt = types.StringValue("")
+	plan.EndDate = types.StringValue("")
 	plan.LastUpdated = types.StringValue(time.Now().Format(time.RFC850))
 
+	// Wait for the VM to run, so dependent resources can use it right away
+	provisioned, err := r.client.WaitForVm(ctx, plan.ID.ValueString())
+	if err != nil {
+		// keep the order in state, so Terraform taints it instead of ordering again
+		plan.Uuid = types.StringValue("")
+		if plan.IpAddress.IsUnknown() {
+			plan.IpAddress = types.StringValue("")
+		}
+		resp.Diagnostics.Append(resp.State.Set(ctx, plan)...)
+		resp.Diagnostics.AddError(
+			"Error Waiting for VM Provisioning",
+			"VM order "+plan.ID.ValueString()+" was placed, but the VM did not finish provisioning: "+err.Error(),
+		)
+		return
+	}
+
+	plan.Uuid = types.StringValue(provisioned.ID)
+	// The IP address is assigned by NewVM when not configured
+	if plan.IpAddress.IsUnknown() {
+		plan.IpAddress = types.StringValue(provisioned.IpAddress)
+	}
+
 	// Set state to fully populated data
 	diags = resp.State.Set(ctx, plan)
 	resp.Diagnostics.Append(diags...)
@@ -292,12 +431,43 @@ func (r *vmResource) Read(ctx context.Context, req resource.ReadRequest, resp *r
 		return
 	}
 
+	readTimeout, diags := state.Timeouts.Read(ctx, defaultVmReadTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
 	vmId := state.ID.ValueString()
+	if vmId == "" && state.ClientReference.ValueString() != "" {
+		// the order of a failed create was never confirmed, find it by its reference
+		order, err := r.client.GetOrderByReference(ctx, state.ClientReference.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddError(
+				"Error Reading VM",
+				"Could not look up the order with client reference "+state.ClientReference.ValueString()+": "+err.Error(),
+			)
+			return
+		}
+		if order == nil {
+			tflog.Warn(ctx, "VM was never ordered, removing it from state", map[string]any{"client_reference": state.ClientReference.ValueString()})
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		vmId = strconv.Itoa(order.ID)
+		state.ID = types.StringValue(vmId)
+	}
 	if vmId != "" {
 		log.Println("Reading VM: ", vmId)
 
 		// Get refreshed vm value from NewVM
-		vm, err := r.client.GetVm(vmId)
+		vm, err := r.client.GetVm(ctx, vmId)
+		if newvm.IsNotFound(err) {
+			tflog.Warn(ctx, "VM no longer exists, removing it from state", map[string]any{"id": vmId})
+			resp.State.RemoveResource(ctx)
+			return
+		}
 		if err != nil {
 			resp.Diagnostics.AddError(
 				"Error Reading VM",
@@ -305,7 +475,10 @@ func (r *vmResource) Read(ctx context.Context, req resource.ReadRequest, resp *r
 			)
 			return
 		}
-		// vm.Vpc is []int32 coming from API
+		// vm.Vpc is []int32 coming from API, keep an empty list configured as such
+		if vm.Vpc == nil && !state.Vpc.IsNull() {
+			vm.Vpc = []int32{}
+		}
 		list, diags := types.ListValueFrom(ctx, types.Int32Type, vm.Vpc)
 		resp.Diagnostics.Append(diags...)
 		if resp.Diagnostics.HasError() {
@@ -313,6 +486,7 @@ func (r *vmResource) Read(ctx context.Context, req resource.ReadRequest, resp *r
 		}
 
 		// Overwrite items with refreshed state
+		state.Uuid = types.StringValue(vm.ID)
 		state.VmProductID = types.StringValue(vm.VmProductID)
 		state.Os = types.StringValue(vm.Os)
 		state.Location = types.StringValue(vm.Location)
@@ -321,10 +495,34 @@ func (r *vmResource) Read(ctx context.Context, req resource.ReadRequest, resp *r
 		state.Cores = types.Int64Value(int64(vm.Cores))
 		state.Disk = types.Int64Value(vm.HdSize)
 		state.Vpc = list
+		state.SshKey = types.StringValue(vm.SshKey)
+		if vm.IsVpcOnly || !state.IsVpcOnly.IsNull() {
+			state.IsVpcOnly = types.BoolValue(vm.IsVpcOnly)
+		}
+		if vm.UseDhcp || !state.UseDhcp.IsNull() {
+			state.UseDhcp = types.BoolValue(vm.UseDhcp)
+		}
 		state.IpAddress = types.StringValue(vm.IpAddress)
 		state.Gateway = types.StringValue(vm.Gateway)
 		state.DnsServer = types.StringValue(vm.DnsServer)
 		state.SubnetMask = types.StringValue(vm.SubnetMask)
+		// keep the ordered values when the order does not report them
+		if vm.Comments != "" || state.Comments.IsNull() {
+			state.Comments = types.StringValue(vm.Comments)
+		}
+		if vm.Description != "" || state.Description.IsNull() {
+			state.Description = types.StringValue(vm.Description)
+		}
+		// the reference is only used when ordering, keep a configured one
+		if state.ClientReference.IsNull() {
+			state.ClientReference = types.StringValue(vm.Reference)
+		}
+		state.PendingChangeAt = types.StringValue(vm.PendingChangeAt)
+		state.EndDate = types.StringValue(vm.EndDate)
+		state.DeletionPolicy = types.StringValue(string(deletionPolicyFromState(state.DeletionPolicy)))
+		if state.EndChildOrders.IsNull() {
+			state.EndChildOrders = types.BoolValue(false)
+		}
 
 		// Set refreshed state
 		diags = resp.State.Set(ctx, &state)
@@ -339,14 +537,26 @@ func (r *vmResource) Read(ctx context.Context, req resource.ReadRequest, resp *r
 func (r *vmResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
 	// Retrieve values from plan
 	var plan vmResourceModel
+	var prior vmResourceModel
+
 	diags := req.Plan.Get(ctx, &plan)
 	resp.Diagnostics.Append(diags...)
+	diags = req.State.Get(ctx, &prior)
+	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	updateTimeout, diags := plan.Timeouts.Update(ctx, defaultVmUpdateTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	// Fetch current VM data from API
-	vmCurrent, err := r.client.GetVm(plan.ID.ValueString())
+	vmCurrent, err := r.client.GetVm(ctx, plan.ID.ValueString())
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Error Reading NewVM VM",
@@ -377,6 +587,10 @@ func (r *vmResource) Update(ctx context.Context, req resource.UpdateRequest, res
 		IsVpcOnly:   plan.IsVpcOnly.ValueBool(),
 		UseDhcp:     plan.UseDhcp.ValueBool(),
 		Vpc:         vpcIDs,
+		Comments:    plan.Comments.ValueString(),
+		Description: plan.Description.ValueString(),
+
+		ApplyChangesAt: plan.ApplyChangesAt.ValueString(),
 	}
 
 	// Static IPs only when applicable, and only if changed
@@ -395,18 +609,21 @@ func (r *vmResource) Update(ctx context.Context, req resource.UpdateRequest, res
 		}
 	}
 
-	// Update existing VM
-	_, errUpdate := r.client.UpdateVm(plan.ID.ValueString(), vmCurrent, vmUpdated)
+	// Update existing VM, this waits for the change request to be applied
+	// unless it is scheduled
+	_, errUpdate := r.client.UpdateVm(ctx, plan.ID.ValueString(), vmCurrent, vmUpdated)
 	if errUpdate != nil {
-		resp.Diagnostics.AddError(
+		addUpdateError(&resp.Diagnostics,
 			"Error Updating NewVM Vm",
-			"Could not update VM, unexpected error: "+errUpdate.Error(),
+			"Could not update VM, unexpected error: ",
+			errUpdate,
+			changedVmAttributes(prior, plan),
 		)
 		return
 	}
 
 	// Fetch updated items from GetVm as UpdateVm items are not populated.
-	vmNew, errGet := r.client.GetVm(plan.ID.ValueString())
+	vmNew, errGet := r.client.GetVm(ctx, plan.ID.ValueString())
 	if errGet != nil {
 		resp.Diagnostics.AddError(
 			"Error Reading NewVM VM",
@@ -415,7 +632,10 @@ func (r *vmResource) Update(ctx context.Context, req resource.UpdateRequest, res
 		return
 	}
 
-	// vm.Vpc is []int32 coming from API
+	// vm.Vpc is []int32 coming from API, keep an empty list configured as such
+	if vmNew.Vpc == nil && !plan.Vpc.IsNull() {
+		vmNew.Vpc = []int32{}
+	}
 	list, diags := types.ListValueFrom(ctx, types.Int32Type, vmNew.Vpc)
 	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
@@ -423,6 +643,7 @@ func (r *vmResource) Update(ctx context.Context, req resource.UpdateRequest, res
 	}
 
 	// Update resource state with updated items and timestamp
+	plan.Uuid = types.StringValue(vmNew.ID)
 	plan.VmProductID = types.StringValue(vmNew.VmProductID)
 	plan.Os = types.StringValue(vmNew.Os)
 	plan.Location = types.StringValue(vmNew.Location)
@@ -436,6 +657,9 @@ func (r *vmResource) Update(ctx context.Context, req resource.UpdateRequest, res
 	plan.Gateway = types.StringValue(vmNew.Gateway)
 	plan.DnsServer = types.StringValue(vmNew.DnsServer)
 	plan.SubnetMask = types.StringValue(vmNew.SubnetMask)
+	plan.Comments = types.StringValue(vmNew.Comments)
+	plan.Description = types.StringValue(vmNew.Description)
+	plan.PendingChangeAt = types.StringValue(vmNew.PendingChangeAt)
 	plan.LastUpdated = types.StringValue(time.Now().Format(time.RFC850))
 
 	diags = resp.State.Set(ctx, plan)
@@ -453,17 +677,41 @@ func (r *vmResource) Delete(ctx context.Context, req resource.DeleteRequest, res
 	if resp.Diagnostics.HasError() {
 		return
 	}
+
+	deleteTimeout, diags := state.Timeouts.Delete(ctx, defaultVmDeleteTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	vmID := state.ID.ValueString()
+	if vmID == "" && state.ClientReference.ValueString() != "" {
+		// the order of a failed create was never confirmed, find it by its reference
+		order, err := r.client.GetOrderByReference(ctx, state.ClientReference.ValueString())
+		if err != nil {
+			addDeleteVmError(&resp.Diagnostics, err)
+			return
+		}
+		if order == nil {
+			tflog.Warn(ctx, "VM was never ordered, removing it from state", map[string]any{"client_reference": state.ClientReference.ValueString()})
+			return
+		}
+		vmID = strconv.Itoa(order.ID)
+	}
 	if vmID != "" {
 		// Delete existing vm
-		err := r.client.DeleteVm(state.ID.ValueString())
+		endDate, err := r.client.DeleteVm(ctx, vmID, deletionPolicyFromState(state.DeletionPolicy), state.EndChildOrders.ValueBool())
+		if newvm.IsNotFound(err) {
+			tflog.Warn(ctx, "VM no longer exists, removing it from state", map[string]any{"id": vmID})
+			return
+		}
 		if err != nil {
-			resp.Diagnostics.AddError(
-				"Error Deleting VM",
-				"Could not delete VM, unexpected error: "+err.Error(),
-			)
+			addDeleteVmError(&resp.Diagnostics, err)
 			return
 		}
+		addDeletionWarning(&resp.Diagnostics, "VM", vmID, endDate)
 	} else {
 		resp.Diagnostics.AddError(
 			"Error Deleting VM",
@@ -481,12 +729,12 @@ func (r *vmResource) Configure(_ context.Context, req resource.ConfigureRequest,
 		return
 	}
 
-	client, ok := req.ProviderData.(*newvm.Client)
+	client, ok := req.ProviderData.(newvm.API)
 
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *newvm.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected newvm.API, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
@@ -500,6 +748,73 @@ func (r *vmResource) ImportState(ctx context.Context, req resource.ImportStateRe
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
+// addCreateVmError reports a VM that could not be ordered. Several orders
+// with its reference are listed, as only the user knows which one is its own.
+func addCreateVmError(diags *diag.Diagnostics, promoCodes []string, err error) {
+	var referenceErr *newvm.AmbiguousReferenceError
+	if !errors.As(err, &referenceErr) {
+		addCreateError(diags, "Error creating VM", "Could not create VM, unexpected error: ", promoCodes, err)
+		return
+	}
+
+	var orders strings.Builder
+	for _, order := range referenceErr.Orders {
+		fmt.Fprintf(&orders, "\n  - order %d (%s)", order.ID, order.ProductID)
+	}
+	diags.AddError(
+		"Several VM Orders With The Same Reference",
+		fmt.Sprintf("Could not create VM, these running orders were all placed with reference %s and could belong to it:%s\n\n", referenceErr.Reference, orders.String())+
+			"Import the order of this VM, or set client_reference to a value that no other order was placed with. "+
+			"No VM was ordered.",
+	)
+}
+
+// changedVmAttributes returns the paths of the attributes that are changed
+// through a change request.
+func changedVmAttributes(prior, plan vmResourceModel) []path.Path {
+	var changed []path.Path
+	if !plan.VmProductID.Equal(prior.VmProductID) {
+		changed = append(changed, path.Root("product"))
+	}
+	if !plan.Ram.Equal(prior.Ram) {
+		changed = append(changed, path.Root("ram"))
+	}
+	if !plan.Cores.Equal(prior.Cores) {
+		changed = append(changed, path.Root("cores"))
+	}
+	if !plan.Disk.Equal(prior.Disk) {
+		changed = append(changed, path.Root("disk"))
+	}
+	return changed
+}
+
+// vmChangeRequest returns the attributes a plan of the VM changes through a
+// change request, none when the VM is replaced.
+func vmChangeRequest(ctx context.Context, plan tfsdk.Plan, state tfsdk.State) ([]path.Path, diag.Diagnostics) {
+	var planned, prior vmResourceModel
+	diags := plan.Get(ctx, &planned)
+	diags.Append(state.Get(ctx, &prior)...)
+	if diags.HasError() {
+		return nil, diags
+	}
+	if !planned.Os.Equal(prior.Os) || productPrefixChanges(prior.VmProductID.ValueString(), planned.VmProductID.ValueString()) {
+		return nil, diags
+	}
+	return changedVmAttributes(prior, planned), diags
+}
+
+// productPrefixChanges reports whether a product change moves the VM between
+// the 'VM-A' and 'VM-B' product lines, which cannot be done in place.
+func productPrefixChanges(prior, planned string) bool {
+	if len(prior) < 4 || len(planned) < 4 {
+		return false
+	}
+	prefixPrior := prior[:4]
+	prefixPlanned := planned[:4]
+	return (prefixPlanned == "VM-A" && prefixPrior == "VM-B") ||
+		(prefixPlanned == "VM-B" && prefixPrior == "VM-A")
+}
+
 type productPrefixReplaceModifier struct{}
 
 func (m productPrefixReplaceModifier) PlanModifyString(
@@ -513,17 +828,8 @@ func (m productPrefixReplaceModifier) PlanModifyString(
 		return
 	}
 
-	planStr := req.PlanValue.ValueString()
-	stateStr := req.StateValue.ValueString()
-
-	if len(planStr) >= 4 && len(stateStr) >= 4 {
-		prefixPlan := planStr[:4]
-		prefixState := stateStr[:4]
-
-		if (prefixPlan == "VM-A" && prefixState == "VM-B") ||
-			(prefixPlan == "VM-B" && prefixState == "VM-A") {
-			resp.RequiresReplace = true
-		}
+	if productPrefixChanges(req.StateValue.ValueString(), req.PlanValue.ValueString()) {
+		resp.RequiresReplace = true
 	}
 }
 
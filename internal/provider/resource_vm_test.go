@@ -0,0 +1,926 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"unithost-terraform/internal/newvm"
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/plancheck"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+)
+
+func newTestVmModel() vmResourceModel {
+	return vmResourceModel{
+		ID:          types.StringUnknown(),
+		Uuid:        types.StringUnknown(),
+		VmProductID: types.StringValue("VM-A2"),
+		Os:          types.StringValue("debian-12"),
+		Hostname:    types.StringValue("web1.example.com"),
+		Location:    types.StringValue("AMS1"),
+		Ram:         types.Int64Value(2),
+		Cores:       types.Int64Value(1),
+		Disk:        types.Int64Value(20),
+		Comments:    types.StringValue(""),
+		Description: types.StringValue(""),
+		SshKey:      types.StringValue(""),
+		IsVpcOnly:   types.BoolNull(),
+		UseDhcp:     types.BoolNull(),
+		Vpc:         types.ListValueMust(types.Int32Type, nil),
+		IpAddress:   types.StringUnknown(),
+		SubnetMask:  types.StringValue(""),
+		Gateway:     types.StringValue(""),
+		DnsServer:   types.StringValue(""),
+		PromoCodes:  types.SetNull(types.StringType),
+		LastUpdated: types.StringUnknown(),
+
+		ClientReference: types.StringUnknown(),
+	}
+}
+
+// newTestVmState returns the state of VM order 1001 created from
+// newTestVmModel, changed by changes.
+func newTestVmState(changes ...func(*vmResourceModel)) vmResourceModel {
+	m := newTestVmModel()
+	m.ID = types.StringValue("1001")
+	m.Uuid = types.StringValue("00000000-0000-0000-0000-000000001001")
+	m.IpAddress = types.StringValue("")
+	m.ClientReference = types.StringValue("tf-0000000000000001")
+	m.PendingChangeAt = types.StringValue("")
+	m.EndDate = types.StringValue("")
+	m.LastUpdated = types.StringValue("")
+	for _, change := range changes {
+		change(&m)
+	}
+	return m
+}
+
+// newTestVm returns VM order 1001 as the API reports it for newTestVmState,
+// changed by changes.
+func newTestVm(changes ...func(*newvm.Vm)) newvm.Vm {
+	vm := newvm.Vm{
+		OrderID:     1001,
+		ID:          "00000000-0000-0000-0000-000000001001",
+		VmProductID: "VM-A2",
+		Os:          "debian-12",
+		Hostname:    "web1.example.com",
+		Location:    "AMS1",
+		Ram:         2,
+		Cores:       1,
+		HdSize:      20,
+		Reference:   "tf-0000000000000001",
+	}
+	for _, change := range changes {
+		change(&vm)
+	}
+	return vm
+}
+
+// refreshed sets the values Read fills in for a state that lacks them.
+func refreshed(m *vmResourceModel) {
+	m.DeletionPolicy = types.StringValue(string(newvm.DeletionPolicyEndOfBillingPeriod))
+	m.EndChildOrders = types.BoolValue(false)
+}
+
+func TestVmResource(t *testing.T) {
+	withVm := func(changes ...func(*newvm.Vm)) func(api *fakeAPI) {
+		return func(api *fakeAPI) {
+			api.vms["1001"] = newTestVm(changes...)
+		}
+	}
+	unconfirmed := func(m *vmResourceModel) {
+		m.ID = types.StringValue("")
+		m.Uuid = types.StringValue("")
+	}
+
+	runResourceTests(t, func(api *fakeAPI) fwresource.Resource { return &vmResource{client: api} }, []resourceTest{
+		{
+			name:   "create",
+			method: "Create",
+			plan:   newTestVmModel(),
+			calls:  []string{"CreateVm", "WaitForVm"},
+			// ip_address is assigned by NewVM when it is not configured
+			expected: newTestVmState(func(m *vmResourceModel) {
+				m.ClientReference = types.StringValue("(reference)")
+				m.LastUpdated = types.StringValue("(now)")
+			}),
+			check: func(t *testing.T, api *fakeAPI) {
+				if vm := api.vms["1001"]; vm.Hostname != "web1.example.com" || vm.Ram != 2 {
+					t.Fatalf("unexpected order sent to API: %+v", vm)
+				}
+			},
+		},
+		{
+			// the order was placed, so it must be tracked for Terraform to taint it
+			name:   "create with failed provisioning",
+			setup:  func(api *fakeAPI) { api.provisioningErr = errors.New("timed out") },
+			method: "Create",
+			plan:   newTestVmModel(),
+			calls:  []string{"CreateVm", "WaitForVm"},
+			errors: []string{""},
+			expected: newTestVmState(func(m *vmResourceModel) {
+				m.Uuid = types.StringValue("")
+				m.ClientReference = types.StringValue("(reference)")
+				m.LastUpdated = types.StringValue("(now)")
+			}),
+		},
+		{
+			// the order may have been placed, its reference is kept for Terraform to taint it
+			name: "create with unconfirmed order",
+			setup: func(api *fakeAPI) {
+				api.orderErr = &newvm.OrderNotConfirmedError{Reference: "tf-0000000000000001", Err: errors.New("gateway timeout")}
+			},
+			method: "Create",
+			plan:   newTestVmModel(),
+			calls:  []string{"CreateVm"},
+			errors: []string{""},
+			expected: newTestVmState(unconfirmed, func(m *vmResourceModel) {
+				m.ClientReference = types.StringValue("(reference)")
+				m.LastUpdated = types.StringValue("(now)")
+			}),
+		},
+		{
+			// changes made outside of Terraform are picked up, the API omits
+			// the VPCs of a VM without any, a configured empty list must not
+			// be read back as null
+			name:     "read",
+			setup:    withVm(func(vm *newvm.Vm) { vm.Cores = 4 }),
+			method:   "Read",
+			state:    newTestVmState(),
+			calls:    []string{"GetVm"},
+			expected: newTestVmState(refreshed, func(m *vmResourceModel) { m.Cores = types.Int64Value(4) }),
+		},
+		{
+			// settings changed outside of Terraform show up as drift, unset
+			// optional booleans that are false on the API stay null, the
+			// order details are refreshed when the order reports them
+			name: "read provisioning settings",
+			setup: withVm(func(vm *newvm.Vm) {
+				vm.SshKey = "ssh-ed25519 AAAA"
+				vm.IsVpcOnly = true
+				vm.Description = "webshop"
+			}),
+			method: "Read",
+			state:  newTestVmState(func(m *vmResourceModel) { m.Comments = types.StringValue("cost center 4711") }),
+			calls:  []string{"GetVm"},
+			expected: newTestVmState(refreshed, func(m *vmResourceModel) {
+				m.SshKey = types.StringValue("ssh-ed25519 AAAA")
+				m.IsVpcOnly = types.BoolValue(true)
+				m.Description = types.StringValue("webshop")
+				m.Comments = types.StringValue("cost center 4711")
+			}),
+		},
+		{
+			// NewVM did place the unconfirmed order, the refresh finds it by its reference
+			name:     "read unconfirmed order",
+			setup:    withVm(),
+			method:   "Read",
+			state:    newTestVmState(unconfirmed),
+			calls:    []string{"GetOrderByReference", "GetVm"},
+			expected: newTestVmState(refreshed),
+		},
+		{
+			name:   "read unconfirmed order never placed",
+			method: "Read",
+			state:  newTestVmState(unconfirmed),
+			calls:  []string{"GetOrderByReference"},
+		},
+		{
+			name:   "read deleted VM",
+			method: "Read",
+			state:  newTestVmState(),
+			calls:  []string{"GetVm"},
+		},
+		{
+			name:   "update",
+			setup:  withVm(),
+			method: "Update",
+			state:  newTestVmState(),
+			plan: newTestVmState(func(m *vmResourceModel) {
+				m.Ram = types.Int64Value(8)
+				m.Vpc = types.ListValueMust(types.Int32Type, []attr.Value{types.Int32Value(100)})
+			}),
+			calls: []string{"GetVm", "UpdateVm", "GetVm"},
+			expected: newTestVmState(func(m *vmResourceModel) {
+				m.Ram = types.Int64Value(8)
+				m.Vpc = types.ListValueMust(types.Int32Type, []attr.Value{types.Int32Value(100)})
+				m.LastUpdated = types.StringValue("(now)")
+			}),
+		},
+		{
+			// the provisioning error is reported on the changed attribute
+			name: "update with failed change request",
+			setup: func(api *fakeAPI) {
+				withVm()(api)
+				api.changeErr = &newvm.ChangeRequestError{OrderID: 1001, ChangeRequestID: 7, Message: "insufficient capacity"}
+			},
+			method:   "Update",
+			state:    newTestVmState(),
+			plan:     newTestVmState(func(m *vmResourceModel) { m.Ram = types.Int64Value(64) }),
+			calls:    []string{"GetVm", "UpdateVm"},
+			errors:   []string{"ram"},
+			expected: newTestVmState(),
+		},
+		{
+			name:   "delete",
+			setup:  withVm(),
+			method: "Delete",
+			state:  newTestVmState(),
+			calls:  []string{"DeleteVm"},
+		},
+		{
+			// an order removed outside of Terraform must not keep the VM in state
+			name:   "delete deleted VM",
+			method: "Delete",
+			state:  newTestVmState(),
+			calls:  []string{"DeleteVm"},
+		},
+		{
+			// destroying the tainted VM ends the order found by its reference
+			name:   "delete unconfirmed order",
+			setup:  withVm(),
+			method: "Delete",
+			state:  newTestVmState(unconfirmed),
+			calls:  []string{"GetOrderByReference", "DeleteVm"},
+		},
+		{
+			// without an order there is nothing to delete
+			name:   "delete unconfirmed order never placed",
+			method: "Delete",
+			state:  newTestVmState(unconfirmed),
+			calls:  []string{"GetOrderByReference"},
+		},
+	})
+}
+
+func TestVmResourceConfigure(t *testing.T) {
+	r := &vmResource{}
+
+	var resp fwresource.ConfigureResponse
+	r.Configure(context.Background(), fwresource.ConfigureRequest{ProviderData: newFakeAPI()}, &resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Configure: %v", resp.Diagnostics.Errors())
+	}
+	if _, ok := r.client.(*fakeAPI); !ok {
+		t.Fatalf("Configure: expected the fake API client, got %T", r.client)
+	}
+
+	resp = fwresource.ConfigureResponse{}
+	r.Configure(context.Background(), fwresource.ConfigureRequest{ProviderData: "not a client"}, &resp)
+	if !resp.Diagnostics.HasError() {
+		t.Fatal("Configure: expected an error for unexpected provider data")
+	}
+}
+
+func TestAccVmResource(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	config := func(product string, ram, cores, disk int, vpc string) string {
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vpc" "backend" {
+  name = "backend"
+}
+
+resource "newvm_vm" "web" {
+  product  = %q
+  os       = "debian-12"
+  hostname = "web1.example.com"
+  location = "AMS1"
+  ram      = %d
+  cores    = %d
+  disk     = %d
+  use_dhcp = true
+  vpc      = %s
+}
+`, product, ram, cores, disk, vpc)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+		Steps: []resource.TestStep{
+			// Create and Read testing
+			{
+				Config: config("VM-A1", 0, 0, 0, "[]"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrSet("newvm_vm.web", "id"),
+					resource.TestCheckResourceAttrSet("newvm_vm.web", "uuid"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "product", "VM-A1"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "os", "debian-12"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "location", "AMS1"),
+					resource.TestCheckResourceAttrSet("newvm_vm.web", "ip_address"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "vpc.#", "0"),
+				),
+			},
+			// ImportState testing
+			{
+				ResourceName:      "newvm_vm.web",
+				ImportState:       true,
+				ImportStateVerify: true,
+				// last_updated is only set by Terraform
+				ImportStateVerifyIgnore: []string{"last_updated"},
+			},
+			// Resize through a change request that takes a while to be applied
+			{
+				PreConfig: func() { s.SlowChanges(3) },
+				Config:    config("VM-A2", 2, 1, 10, "[]"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "product", "VM-A2"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "ram", "2"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "cores", "1"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "disk", "10"),
+					testAccCheckOrderOption(s, "newvm_vm.web", "vm_type", 1),
+					testAccCheckOrderOption(s, "newvm_vm.web", "vm_mem", 2),
+					testAccCheckOrderOption(s, "newvm_vm.web", "vm_core", 1),
+					testAccCheckOrderOption(s, "newvm_vm.web", "vm_diskspace", 10),
+				),
+			},
+			// Attach a VPC
+			{
+				Config: config("VM-A2", 2, 1, 10, "[newvm_vpc.backend.number]"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "vpc.#", "1"),
+					resource.TestCheckResourceAttrPair("newvm_vm.web", "vpc.0", "newvm_vpc.backend", "number"),
+					testAccCheckVpcMembers(s, "newvm_vm.web", 1),
+				),
+			},
+			// Detach the VPC again
+			{
+				Config: config("VM-A2", 2, 1, 10, "[]"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "vpc.#", "0"),
+					testAccCheckVpcMembers(s, "newvm_vm.web", 0),
+				),
+			},
+			// Delete testing automatically occurs in TestCase
+		},
+	})
+}
+
+func TestAccVmResourceInVpc(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+		Steps: []resource.TestStep{
+			{
+				Config: s.ProviderConfig() + `
+resource "newvm_vpc" "backend" {
+  name = "backend"
+}
+
+resource "newvm_vm" "db" {
+  product     = "VM-B1"
+  os          = "ubuntu-24.04"
+  hostname    = "db1.example.com"
+  is_vpc_only = true
+  ip_address  = "192.168.10.5"
+  subnet_mask = "255.255.255.0"
+  gateway     = "192.168.10.1"
+  dns_server  = "192.168.10.1"
+  vpc         = [newvm_vpc.backend.number]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.db", "ip_address", "192.168.10.5"),
+					resource.TestCheckResourceAttrPair("newvm_vm.db", "vpc.0", "newvm_vpc.backend", "number"),
+					testAccCheckVpcMembers(s, "newvm_vm.db", 1),
+				),
+			},
+		},
+	})
+}
+
+func TestAccVmResourceWaitsForProvisioning(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	s.SlowProvisioning(3)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+		Steps: []resource.TestStep{
+			{
+				Config: s.ProviderConfig() + `
+resource "newvm_vm" "web" {
+  product  = "VM-A1"
+  os       = "debian-12"
+  hostname = "web1.example.com"
+  use_dhcp = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckVmProvisioned(s, "newvm_vm.web"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccVmResourceCreateTimeout(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	s.SlowProvisioning(1_000_000)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+		Steps: []resource.TestStep{
+			{
+				Config: s.ProviderConfig() + `
+resource "newvm_vm" "web" {
+  product  = "VM-A1"
+  os       = "debian-12"
+  hostname = "web1.example.com"
+  use_dhcp = true
+
+  timeouts {
+    create = "1s"
+  }
+}
+`,
+				ExpectError: regexp.MustCompile(`did not finish provisioning`),
+			},
+		},
+	})
+}
+
+func TestAccVmResourceFailedChangeRequest(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	config := func(ram int) string {
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product  = "VM-A1"
+  os       = "debian-12"
+  hostname = "web1.example.com"
+  use_dhcp = true
+  ram      = %d
+}
+`, ram)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+		Steps: []resource.TestStep{
+			{
+				Config: config(0),
+			},
+			// The failed change is reported and not recorded in state
+			{
+				PreConfig:   func() { s.FailChanges("insufficient memory on host") },
+				Config:      config(64),
+				ExpectError: regexp.MustCompile(`insufficient memory\s+on host`),
+			},
+			{
+				PreConfig: func() { s.FailChanges("") },
+				Config:    config(64),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "ram", "64"),
+					testAccCheckOrderOption(s, "newvm_vm.web", "vm_mem", 64),
+				),
+			},
+		},
+	})
+}
+
+func TestAccVmResourcePromoCodes(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	s.AddPromoCodes("WELCOME10")
+
+	config := func(promoCode string) string {
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product     = "VM-A1"
+  os          = "debian-12"
+  hostname    = "web1.example.com"
+  use_dhcp    = true
+  promo_codes = [%q]
+}
+`, promoCode)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+		Steps: []resource.TestStep{
+			{
+				Config:      config("NOSUCHCODE"),
+				ExpectError: regexp.MustCompile(`(?s)Invalid Promo Code.*promo code "NOSUCHCODE" is not valid`),
+			},
+			{
+				Config: config("WELCOME10"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "promo_codes.#", "1"),
+					testAccCheckOrderPromoCodes(s, "newvm_vm.web", "WELCOME10"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccVmResourceDescription(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	config := func(description, comments string) string {
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product     = "VM-A1"
+  os          = "debian-12"
+  hostname    = "web1.example.com"
+  use_dhcp    = true
+  description = %q
+  comments    = %q
+}
+`, description, comments)
+	}
+
+	testAccCheckOrderDetails := func(description, comments string) resource.TestCheckFunc {
+		return func(state *terraform.State) error {
+			order, err := testAccOrder(s, state, "newvm_vm.web")
+			if err != nil {
+				return err
+			}
+			if order.Description != description || order.Comments != comments {
+				return fmt.Errorf("order %d: expected description %q and comments %q, got %q and %q", order.ID, description, comments, order.Description, order.Comments)
+			}
+			return nil
+		}
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+		Steps: []resource.TestStep{
+			{
+				Config: config("webshop frontend", "cost center 4711"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "description", "webshop frontend"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "comments", "cost center 4711"),
+					testAccCheckOrderDetails("webshop frontend", "cost center 4711"),
+				),
+			},
+			// Description and comments are read back from the order
+			{
+				ResourceName:            "newvm_vm.web",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"last_updated"},
+			},
+			// Changing them orders a new VM, the order API has no verified way to update them
+			{
+				Config: config("webshop backend", ""),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectResourceAction("newvm_vm.web", plancheck.ResourceActionReplace),
+					},
+				},
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "description", "webshop backend"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "comments", ""),
+					testAccCheckOrderDetails("webshop backend", ""),
+				),
+			},
+		},
+	})
+}
+
+func TestAccVmResourceScheduledChange(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	applyAt := time.Now().UTC().Add(2 * time.Hour).Truncate(time.Second).Format(time.RFC3339)
+
+	config := func(applyChangesAt string, ram int) string {
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product          = "VM-A1"
+  os               = "debian-12"
+  hostname         = "web1.example.com"
+  use_dhcp         = true
+  ram              = %d
+  apply_changes_at = %q
+
+  timeouts {
+    update = "5s"
+  }
+}
+`, ram, applyChangesAt)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+		Steps: []resource.TestStep{
+			{
+				Config:      config("tonight", 0),
+				ExpectError: regexp.MustCompile(`Invalid Timestamp`),
+			},
+			{
+				Config: config(applyAt, 0),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "pending_change_at", ""),
+				),
+			},
+			// The resize is scheduled, the state shows it as pending without a diff
+			{
+				Config: config(applyAt, 4),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "ram", "4"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "pending_change_at", applyAt),
+					testAccCheckOrderOption(s, "newvm_vm.web", "vm_mem", 0),
+				),
+			},
+			// Once NewVM applied it, nothing is pending anymore
+			{
+				PreConfig: s.ApplyChanges,
+				Config:    config(applyAt, 4),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "ram", "4"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "pending_change_at", ""),
+					testAccCheckOrderOption(s, "newvm_vm.web", "vm_mem", 4),
+				),
+			},
+		},
+	})
+}
+
+func TestAccVmResourceDeletionPolicy(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+
+	config := func(billingTimezone, deletionPolicy string) string {
+		return s.ProviderConfig(fmt.Sprintf("billing_timezone = %q", billingTimezone)) + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product         = "VM-A1"
+  os              = "debian-12"
+  hostname        = "web1.example.com"
+  use_dhcp        = true
+  deletion_policy = %q
+}
+`, deletionPolicy)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateIs(time.Now().In(newYork).Format(time.DateOnly))),
+		Steps: []resource.TestStep{
+			{
+				Config:      config("America/New_York", "now"),
+				ExpectError: regexp.MustCompile(`Invalid Deletion Policy`),
+			},
+			{
+				Config:      config("Mars/Olympus_Mons", "immediate"),
+				ExpectError: regexp.MustCompile(`Invalid NewVM Billing Timezone`),
+			},
+			{
+				Config: config("America/New_York", "immediate"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "deletion_policy", "immediate"),
+					resource.TestCheckResourceAttr("newvm_vm.web", "end_date", ""),
+				),
+			},
+		},
+	})
+}
+
+func TestAccVmResourceDeletionPolicyStopOnly(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy: resource.ComposeAggregateTestCheckFunc(
+			testAccCheckOrdersEndDate(s, "newvm_vm", endDateIs("")),
+			func(state *terraform.State) error {
+				order, err := testAccOrder(s, state, "newvm_vm.web")
+				if err != nil {
+					return err
+				}
+				if order.VmStatus != "STOPPED" {
+					return fmt.Errorf("order %d: expected a stopped VM, got %q", order.ID, order.VmStatus)
+				}
+				return nil
+			},
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: s.ProviderConfig() + `
+resource "newvm_vm" "web" {
+  product         = "VM-A1"
+  os              = "debian-12"
+  hostname        = "web1.example.com"
+  use_dhcp        = true
+  deletion_policy = "stop_only"
+}
+`,
+				Check: resource.TestCheckResourceAttr("newvm_vm.web", "deletion_policy", "stop_only"),
+			},
+		},
+	})
+}
+
+func TestAccVmResourceChildOrders(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	var controlPanelID int
+
+	config := func(endChildOrders bool) string {
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vm" "web" {
+  product          = "VM-A1"
+  os               = "debian-12"
+  hostname         = "web1.example.com"
+  use_dhcp         = true
+  end_child_orders = %t
+}
+`, endChildOrders)
+	}
+
+	// orderControlPanel places a control panel under the VM outside of Terraform
+	orderControlPanel := func(state *terraform.State) error {
+		order, err := testAccOrder(s, state, "newvm_vm.web")
+		if err != nil {
+			return err
+		}
+		client, err := newvm.NewClient(context.Background(), &s.URL, &s.Username, &s.Password, nil)
+		if err != nil {
+			return err
+		}
+		controlPanel, err := client.CreateControlPanel(context.Background(), newvm.ControlPanel{VmID: order.ID, ProductID: "CP_PLESK.plesk_12_license.1"})
+		if err != nil {
+			return err
+		}
+		controlPanelID = controlPanel.ID
+		return nil
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy: resource.ComposeAggregateTestCheckFunc(
+			testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+			func(*terraform.State) error {
+				if order, _ := s.Order(controlPanelID); order.EndDate == "" {
+					return fmt.Errorf("expected control panel order %d to end with the VM", controlPanelID)
+				}
+				return nil
+			},
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: config(false),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "end_child_orders", "false"),
+					orderControlPanel,
+				),
+			},
+			{
+				Config:      config(false),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile(`(?s)VM Has Running Child Orders.*CP_PLESK`),
+			},
+			{
+				Config: config(true),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vm.web", "end_child_orders", "true"),
+					testAccCheckVmProvisioned(s, "newvm_vm.web"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccVmResourceAdoptsLostOrder(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+		Steps: []resource.TestStep{
+			// NewVM places the order, but the response never reaches the provider
+			{
+				PreConfig: func() { s.LoseOrderResponses(1) },
+				Config: s.ProviderConfig() + `
+resource "newvm_vm" "web" {
+  product  = "VM-A1"
+  os       = "debian-12"
+  hostname = "web1.example.com"
+  use_dhcp = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestMatchResourceAttr("newvm_vm.web", "client_reference", regexp.MustCompile(`^tf-[0-9a-f]{16}$`)),
+					testAccCheckVmProvisioned(s, "newvm_vm.web"),
+					func(*terraform.State) error {
+						orders := 0
+						for _, request := range s.Requests() {
+							if strings.HasPrefix(request, "POST /account/v1/customer/self/order/") {
+								orders++
+							}
+						}
+						if orders != 1 {
+							return fmt.Errorf("expected the VM to be ordered once, got %d orders", orders)
+						}
+						return nil
+					},
+				),
+			},
+			// ImportState testing
+			{
+				ResourceName:            "newvm_vm.web",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"last_updated"},
+			},
+		},
+	})
+}
+
+func TestAccVmResourceRecreateAfterStopOnly(t *testing.T) {
+	s := newvmtest.NewServer(t)
+	var stoppedID string
+
+	config := s.ProviderConfig() + `
+resource "newvm_vm" "web" {
+  product         = "VM-A1"
+  os              = "debian-12"
+  hostname        = "web1.example.com"
+  use_dhcp        = true
+  deletion_policy = "stop_only"
+}
+`
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: func(state *terraform.State) error {
+					stoppedID = state.RootModule().Resources["newvm_vm.web"].Primary.ID
+					return nil
+				},
+			},
+			// Destroying keeps the order of the stopped VM running
+			{
+				Config: s.ProviderConfig(),
+			},
+			// Creating the same VM again orders a new one instead of adopting the stopped VM
+			{
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckVmProvisioned(s, "newvm_vm.web"),
+					func(state *terraform.State) error {
+						if id := state.RootModule().Resources["newvm_vm.web"].Primary.ID; id == stoppedID {
+							return fmt.Errorf("expected a new order, got the order %s of the stopped VM", id)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccVmResourceDuplicateConfiguration(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckOrdersEndDate(s, "newvm_vm", endDateSet),
+		Steps: []resource.TestStep{
+			// Identical VMs under count each get their own order
+			{
+				Config: s.ProviderConfig() + `
+resource "newvm_vm" "web" {
+  count    = 2
+  product  = "VM-A1"
+  os       = "debian-12"
+  hostname = "web.example.com"
+  use_dhcp = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckVmProvisioned(s, "newvm_vm.web.0"),
+					testAccCheckVmProvisioned(s, "newvm_vm.web.1"),
+					func(state *terraform.State) error {
+						first := state.RootModule().Resources["newvm_vm.web.0"].Primary.ID
+						second := state.RootModule().Resources["newvm_vm.web.1"].Primary.ID
+						if first == second {
+							return fmt.Errorf("expected an order per VM, both got order %s", first)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
@@ -8,6 +8,7 @@ import (
 
 	"unithost-terraform/internal/newvm"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
@@ -15,6 +16,7 @@ import (
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
 // Ensure the implementation satisfies the expected interfaces.
@@ -24,6 +26,14 @@ var (
 	_ resource.ResourceWithImportState = &vpcResource{}
 )
 
+// Defaults for the timeouts block.
+const (
+	defaultVpcCreateTimeout = 10 * time.Minute
+	defaultVpcReadTimeout   = 5 * time.Minute
+	defaultVpcUpdateTimeout = 10 * time.Minute
+	defaultVpcDeleteTimeout = 10 * time.Minute
+)
+
 // NewVpcResource is a helper function to simplify the provider implementation.
 func NewVpcResource() resource.Resource {
 	return &vpcResource{}
@@ -31,17 +41,18 @@ func NewVpcResource() resource.Resource {
 
 // vpcResourceModel maps the resource schema data.
 type vpcResourceModel struct {
-	ID          types.String `tfsdk:"id"`
-	Number      types.Int32  `tfsdk:"number"`
-	Name        types.String `tfsdk:"name"`
-	OwnerID     types.Int32  `tfsdk:"owner_id"`
-	Removable   types.Int32  `tfsdk:"removable"`
-	LastUpdated types.String `tfsdk:"last_updated"`
+	ID          types.String   `tfsdk:"id"`
+	Number      types.Int32    `tfsdk:"number"`
+	Name        types.String   `tfsdk:"name"`
+	OwnerID     types.Int32    `tfsdk:"owner_id"`
+	Removable   types.Int32    `tfsdk:"removable"`
+	LastUpdated types.String   `tfsdk:"last_updated"`
+	Timeouts    timeouts.Value `tfsdk:"timeouts"`
 }
 
 // vpcResource is the resource implementation.
 type vpcResource struct {
-	client *newvm.Client
+	client newvm.API
 }
 
 // Metadata returns the resource type name.
@@ -50,7 +61,7 @@ func (r *vpcResource) Metadata(_ context.Context, req resource.MetadataRequest,
 }
 
 // Schema defines the schema for the resource.
-func (r *vpcResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+func (r *vpcResource) Schema(ctx context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
 	resp.Schema = schema.Schema{
 		Description: "Manages a VPC.",
 		Attributes: map[string]schema.Attribute{
@@ -94,6 +105,14 @@ func (r *vpcResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *
 				Computed:    true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -107,13 +126,21 @@ func (r *vpcResource) Create(ctx context.Context, req resource.CreateRequest, re
 		return
 	}
 
+	createTimeout, diags := plan.Timeouts.Create(ctx, defaultVpcCreateTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	// Generate API request body from plan
 	newVpcOrder := newvm.Vpc{
 		Name: plan.Name.ValueString(),
 	}
 
 	// Create new VPC
-	vpc, err := r.client.CreateVpc(newVpcOrder)
+	vpc, err := r.client.CreateVpc(ctx, newVpcOrder)
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Error creating VPC",
@@ -128,7 +155,7 @@ func (r *vpcResource) Create(ctx context.Context, req resource.CreateRequest, re
 	plan.LastUpdated = types.StringValue(time.Now().Format(time.RFC850))
 
 	// Try to read back
-	if cp, err := r.client.GetVpc(vpc.ID); err == nil {
+	if cp, err := r.client.GetVpc(ctx, vpc.ID); err == nil {
 		plan.Number = types.Int32Value(cp.Number)
 		plan.OwnerID = types.Int32Value(cp.OwnerID)
 		plan.Removable = types.Int32Value(int32(cp.Removable))
@@ -153,12 +180,25 @@ func (r *vpcResource) Read(ctx context.Context, req resource.ReadRequest, resp *
 		return
 	}
 
+	readTimeout, diags := state.Timeouts.Read(ctx, defaultVpcReadTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
 	vpcId := state.ID.ValueString()
 	if vpcId != "" {
 		log.Println("Reading VPC: ", vpcId)
 
 		// Get refreshed VPC value from NewVM
-		vpc, err := r.client.GetVpc(vpcId)
+		vpc, err := r.client.GetVpc(ctx, vpcId)
+		if newvm.IsNotFound(err) {
+			tflog.Warn(ctx, "VPC no longer exists, removing it from state", map[string]any{"id": vpcId})
+			resp.State.RemoveResource(ctx)
+			return
+		}
 		if err != nil {
 			resp.Diagnostics.AddError(
 				"Error Reading VPC",
@@ -198,13 +238,21 @@ func (r *vpcResource) Update(ctx context.Context, req resource.UpdateRequest, re
 		return
 	}
 
+	updateTimeout, diags := plan.Timeouts.Update(ctx, defaultVpcUpdateTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	// Generate API request body from plan
 	updateVpcOrder := newvm.Vpc{
 		Name: plan.Name.ValueString(),
 	}
 
 	// Update existing VPC
-	err := r.client.UpdateVpc(plan.ID.ValueString(), updateVpcOrder)
+	err := r.client.UpdateVpc(ctx, plan.ID.ValueString(), updateVpcOrder)
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Error Updating NewVM VPC",
@@ -230,10 +278,19 @@ func (r *vpcResource) Delete(ctx context.Context, req resource.DeleteRequest, re
 	if resp.Diagnostics.HasError() {
 		return
 	}
+
+	deleteTimeout, diags := state.Timeouts.Delete(ctx, defaultVpcDeleteTimeout)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	vpcID := state.ID.ValueString()
 	if vpcID != "" {
 		// Delete existing VPC
-		err := r.client.DeleteVpc(vpcID)
+		err := r.client.DeleteVpc(ctx, vpcID)
 		if err != nil {
 			resp.Diagnostics.AddError(
 				"Error Deleting VPC",
@@ -258,12 +315,12 @@ func (r *vpcResource) Configure(_ context.Context, req resource.ConfigureRequest
 		return
 	}
 
-	client, ok := req.ProviderData.(*newvm.Client)
+	client, ok := req.ProviderData.(newvm.API)
 
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *newvm.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected newvm.API, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	"unithost-terraform/internal/newvmtest"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+)
+
+func TestAccVpcResource(t *testing.T) {
+	s := newvmtest.NewServer(t)
+
+	config := func(name, timeouts string) string {
+		return s.ProviderConfig() + fmt.Sprintf(`
+resource "newvm_vpc" "backend" {
+  name = %q
+%s}
+`, name, timeouts)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy: func(state *terraform.State) error {
+			for _, rs := range state.RootModule().Resources {
+				if rs.Type == "newvm_vpc" {
+					if _, ok := s.Vpc(100); ok {
+						return fmt.Errorf("VPC %s still exists", rs.Primary.ID)
+					}
+				}
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			// Create and Read testing
+			{
+				Config: config("backend", ""),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrSet("newvm_vpc.backend", "id"),
+					resource.TestCheckResourceAttr("newvm_vpc.backend", "name", "backend"),
+					resource.TestCheckResourceAttr("newvm_vpc.backend", "number", "100"),
+					resource.TestCheckResourceAttr("newvm_vpc.backend", "removable", "1"),
+				),
+			},
+			// ImportState testing
+			{
+				ResourceName:            "newvm_vpc.backend",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"last_updated"},
+			},
+			// Update and Read testing
+			{
+				Config: config("database", ""),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vpc.backend", "name", "database"),
+					resource.TestCheckResourceAttr("newvm_vpc.backend", "number", "100"),
+					func(*terraform.State) error {
+						if vpc, _ := s.Vpc(100); vpc.Label != "database" {
+							return fmt.Errorf("expected VPC label database, got %q", vpc.Label)
+						}
+						return nil
+					},
+				),
+			},
+			// Timeouts are accepted for every operation
+			{
+				Config: config("database", `
+  timeouts {
+    create = "5m"
+    read   = "1m"
+    update = "5m"
+    delete = "5m"
+  }
+`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("newvm_vpc.backend", "timeouts.read", "1m"),
+					resource.TestCheckResourceAttr("newvm_vpc.backend", "timeouts.delete", "5m"),
+				),
+			},
+			// Delete testing automatically occurs in TestCase
+		},
+	})
+}
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+)
+
+// changeRequestFunc returns the paths of the attributes a plan changes
+// through a change request, none when the resource is replaced.
+type changeRequestFunc func(ctx context.Context, plan tfsdk.Plan, state tfsdk.State) ([]path.Path, diag.Diagnostics)
+
+// applyChangesAtAttribute is the apply_changes_at attribute of the resources
+// that are changed through change requests.
+func applyChangesAtAttribute(changed changeRequestFunc) schema.StringAttribute {
+	return schema.StringAttribute{
+		Description: "RFC 3339 time to apply changes at, e.g. '2026-01-31T02:00:00Z' for a nightly maintenance window. " +
+			"Changes are scheduled and Terraform does not wait for them. Without it, changes are applied right away. " +
+			"Changes that need a change request are not planned while the time has passed, set a new time or remove it.",
+		Optional: true,
+		Validators: []validator.String{
+			rfc3339Validator{},
+		},
+		PlanModifiers: []planmodifier.String{
+			applyChangesAtNotPassedModifier{changed: changed},
+		},
+	}
+}
+
+// pendingChangeAtAttribute is the computed counterpart of apply_changes_at.
+func pendingChangeAtAttribute() schema.StringAttribute {
+	return schema.StringAttribute{
+		Description: "Time the pending scheduled change is applied at, empty when no change is scheduled. " +
+			"Until then the attributes show the values of the scheduled change.",
+		Computed: true,
+	}
+}
+
+// rfc3339Validator validates that a string is an RFC 3339 timestamp.
+type rfc3339Validator struct{}
+
+func (v rfc3339Validator) Description(_ context.Context) string {
+	return "value must be an RFC 3339 timestamp"
+}
+
+func (v rfc3339Validator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v rfc3339Validator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if _, err := time.Parse(time.RFC3339, req.ConfigValue.ValueString()); err != nil {
+		resp.Diagnostics.AddAttributeError(
+			req.Path,
+			"Invalid Timestamp",
+			fmt.Sprintf("Expected an RFC 3339 timestamp like 2026-01-31T02:00:00Z, got %q.", req.ConfigValue.ValueString()),
+		)
+	}
+}
+
+// applyChangesAtNotPassedModifier rejects a change request while
+// apply_changes_at has passed. A stale time left in the configuration would
+// otherwise apply the changes right away, outside the intended maintenance
+// window. Other updates and replacements go ahead.
+type applyChangesAtNotPassedModifier struct {
+	changed changeRequestFunc
+}
+
+func (m applyChangesAtNotPassedModifier) Description(_ context.Context) string {
+	return "change requests cannot be planned while the time to apply them at has passed"
+}
+
+func (m applyChangesAtNotPassedModifier) MarkdownDescription(ctx context.Context) string {
+	return m.Description(ctx)
+}
+
+func (m applyChangesAtNotPassedModifier) PlanModifyString(ctx context.Context, req planmodifier.StringRequest, resp *planmodifier.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	// nothing is scheduled on create and destroy, or when nothing changes
+	if req.State.Raw.IsNull() || req.Plan.Raw.IsNull() || req.Plan.Raw.Equal(req.State.Raw) {
+		return
+	}
+
+	applyAt, err := time.Parse(time.RFC3339, req.ConfigValue.ValueString())
+	if err != nil {
+		return // reported by rfc3339Validator
+	}
+	if applyAt.After(time.Now()) {
+		return
+	}
+
+	changed, diags := m.changed(ctx, req.Plan, req.State)
+	resp.Diagnostics.Append(diags...)
+	if len(changed) == 0 {
+		return
+	}
+
+	resp.Diagnostics.AddAttributeError(
+		req.Path,
+		"Time To Apply Changes Has Passed",
+		fmt.Sprintf("apply_changes_at is %s, which has passed, so the changes to %s would be applied right away. "+
+			"Set a future time to schedule them, or remove apply_changes_at to apply them right away.", req.ConfigValue.ValueString(), changed),
+	)
+}
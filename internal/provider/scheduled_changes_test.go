@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestApplyChangesAtNotPassedModifier(t *testing.T) {
+	ctx := context.Background()
+	r := &vmResource{}
+	passed := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	future := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+
+	model := func(applyAt string, ram int64, changes ...func(*vmResourceModel)) vmResourceModel {
+		m := newTestVmModel()
+		m.ID = types.StringValue("1001")
+		m.IpAddress = types.StringValue("")
+		m.LastUpdated = types.StringValue("")
+		m.ClientReference = types.StringValue("tf-0000000000000001")
+		m.Ram = types.Int64Value(ram)
+		m.ApplyChangesAt = types.StringValue(applyAt)
+		for _, change := range changes {
+			change(&m)
+		}
+		return m
+	}
+
+	tests := []struct {
+		name      string
+		state     vmResourceModel
+		planned   vmResourceModel
+		expectErr bool
+	}{
+		// a stale time would apply the resize right away
+		{name: "passed with changes", state: model(passed, 2), planned: model(passed, 4), expectErr: true},
+		{name: "passed without changes", state: model(passed, 2), planned: model(passed, 2)},
+		{name: "future with changes", state: model(passed, 2), planned: model(future, 4)},
+		// only change requests are scheduled, a stale time must not block anything else
+		{name: "passed with other changes", state: model(passed, 2), planned: model(passed, 2, func(m *vmResourceModel) {
+			m.Description = types.StringValue("web server")
+			m.DeletionPolicy = types.StringValue("immediate")
+		})},
+		{name: "passed with replacement", state: model(passed, 2), planned: model(passed, 4, func(m *vmResourceModel) {
+			m.Os = types.StringValue("ubuntu-24.04")
+		})},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := planmodifier.StringRequest{
+				Path:        path.Root("apply_changes_at"),
+				ConfigValue: test.planned.ApplyChangesAt,
+				Plan:        newTestPlan(t, r, test.planned),
+				State:       newTestState(t, r, test.state),
+			}
+
+			var resp planmodifier.StringResponse
+			applyChangesAtNotPassedModifier{changed: vmChangeRequest}.PlanModifyString(ctx, req, &resp)
+			if resp.Diagnostics.HasError() != test.expectErr {
+				t.Fatalf("expected error %t, got %v", test.expectErr, resp.Diagnostics.Errors())
+			}
+		})
+	}
+}
+
+func TestControlPanelChangeRequest(t *testing.T) {
+	ctx := context.Background()
+	r := &controlPanelResource{}
+
+	model := func(vmID int64, extensions ...string) controlPanelResourceModel {
+		m := controlPanelResourceModel{
+			ID:          types.Int64Value(1002),
+			ProductID:   types.StringValue("CP_PLESK.plesk_12_license.1"),
+			VmID:        types.Int64Value(vmID),
+			PromoCodes:  types.SetNull(types.StringType),
+			LastUpdated: types.StringValue(""),
+		}
+		for _, id := range extensions {
+			m.Extensions = append(m.Extensions, controlPanelExtensionResourceModel{ID: types.StringValue(id), Description: types.StringUnknown(), Price: types.Float64Unknown()})
+		}
+		return m
+	}
+
+	tests := []struct {
+		name     string
+		state    controlPanelResourceModel
+		planned  controlPanelResourceModel
+		expected []path.Path
+	}{
+		{name: "extension added", state: model(1001), planned: model(1001, "wordpress"), expected: []path.Path{path.Root("extensions")}},
+		{name: "replacement", state: model(1001), planned: model(1003, "wordpress")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changed, diags := controlPanelChangeRequest(ctx, newTestPlan(t, r, test.planned), newTestState(t, r, test.state))
+			if diags.HasError() {
+				t.Fatalf("controlPanelChangeRequest: %v", diags.Errors())
+			}
+			if !slices.EqualFunc(changed, test.expected, path.Path.Equal) {
+				t.Fatalf("expected changes to %v, got %v", test.expected, changed)
+			}
+		})
+	}
+}